@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+	"sfpr/util"
+)
+
+type AnnouncementCreate struct {
+	Title      string  `json:"title" binding:"required"`
+	Body       string  `json:"body" binding:"required"`
+	Pinned     bool    `json:"pinned"`
+	SpotTypeID *uint   `json:"spotTypeId"`
+	UserType   *string `json:"userType"`
+	SendEmail  bool    `json:"sendEmail"`
+}
+
+type AnnouncementUpdate struct {
+	Title      *string `json:"title"`
+	Body       *string `json:"body"`
+	Pinned     *bool   `json:"pinned"`
+	SpotTypeID *uint   `json:"spotTypeId"`
+	UserType   *string `json:"userType"`
+	SendEmail  bool    `json:"sendEmail"`
+}
+
+type AnnouncementPage struct {
+	Items    []models.Announcement `json:"items"`
+	Total    int64                 `json:"total"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"pageSize"`
+}
+
+const maxAnnouncementPageSize = 100
+
+func GetAnnouncementById(db *gorm.DB, id string) (models.Announcement, error) {
+	var announcementExist models.Announcement
+	if err := db.First(&announcementExist, "id = ?", id).Error; err != nil {
+		return announcementExist, err
+	}
+	return announcementExist, nil
+}
+
+// audienceScope limits announcements to the ones meant for the given user
+func audienceScope(user models.User) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if user.SpotTypeID != nil {
+			db = db.Where("spot_type_id IS NULL OR spot_type_id = ?", *user.SpotTypeID)
+		} else {
+			db = db.Where("spot_type_id IS NULL")
+		}
+		return db.Where("user_type IS NULL OR user_type = ?", user.Type)
+	}
+}
+
+// sendAnnouncementMails queues the announcement as email for every activated user in its audience.
+// EmailSentAt is only set if mails were actually queued.
+func sendAnnouncementMails(db *gorm.DB, announcement *models.Announcement) (int, error) {
+	query := db.Where("is_activated = ? AND username IS NOT NULL", true)
+	if announcement.SpotTypeID != nil {
+		query = query.Where("spot_type_id = ?", *announcement.SpotTypeID)
+	}
+	if announcement.UserType != nil {
+		query = query.Where("type = ?", *announcement.UserType)
+	}
+	var users []models.User
+	if err := query.Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	mails := make([]util.Mail, 0, len(users))
+	for _, user := range users {
+		mails = append(mails, util.AnnouncementMail(*user.Username, user.Nickname, announcement.Title, announcement.Body))
+	}
+	util.QueueMails(mails)
+	// with email sending disabled nothing went out, so it can still be sent later
+	if !util.EmailsEnabled || len(mails) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	announcement.EmailSentAt = &now
+	if err := db.Model(announcement).Update("email_sent_at", now).Error; err != nil {
+		return len(mails), err
+	}
+	return len(mails), nil
+}
+
+// ##########
+// Handlers
+// ##########
+
+// GetAnnouncements returns the announcements for the current user, pinned ones first
+func GetAnnouncements(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		var userExist models.User
+		if err := db.First(&userExist, userId).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User is not in DB."})
+			return
+		}
+
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+			return
+		}
+		pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+		if err != nil || pageSize < 1 || pageSize > maxAnnouncementPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("pageSize must be between 1 and %d", maxAnnouncementPageSize)})
+			return
+		}
+
+		var total int64
+		if err := db.Model(&models.Announcement{}).Scopes(audienceScope(userExist)).Count(&total).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		announcements := []models.Announcement{}
+		query := db.Scopes(audienceScope(userExist)).Order("pinned desc").Order("created_at desc")
+		if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Find(&announcements).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		for i := range announcements {
+			announcements[i].BodyHTML = util.RenderMarkdown(announcements[i].Body)
+		}
+
+		c.IndentedJSON(http.StatusOK, AnnouncementPage{
+			Items:    announcements,
+			Total:    total,
+			Page:     page,
+			PageSize: pageSize,
+		})
+	}
+}
+
+// GetAllAnnouncements returns every announcement regardless of audience (admin)
+func GetAllAnnouncements(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var announcements []models.Announcement
+		if err := db.Order("pinned desc").Order("created_at desc").Find(&announcements).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		for i := range announcements {
+			announcements[i].BodyHTML = util.RenderMarkdown(announcements[i].Body)
+		}
+		c.IndentedJSON(http.StatusOK, announcements)
+	}
+}
+
+func CreateAnnouncement(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ac AnnouncementCreate
+		if err := c.ShouldBindJSON(&ac); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if ac.SpotTypeID != nil {
+			if err := checkSpot(db, int(*ac.SpotTypeID), false); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Bad Spottype."})
+				return
+			}
+		}
+
+		announcement := models.Announcement{
+			Title:      ac.Title,
+			Body:       ac.Body,
+			Pinned:     ac.Pinned,
+			SpotTypeID: ac.SpotTypeID,
+			UserType:   ac.UserType,
+		}
+		if userId, exists := c.Get("user_id"); exists {
+			authorId := userId.(uint)
+			announcement.AuthorID = &authorId
+		}
+		if err := db.Create(&announcement).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create announcement"})
+			return
+		}
+
+		if ac.SendEmail {
+			if _, err := sendAnnouncementMails(db, &announcement); err != nil {
+				fmt.Println("Error was ", err.Error())
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Announcement was saved, but the emails could not be sent"})
+				return
+			}
+		}
+		announcement.BodyHTML = util.RenderMarkdown(announcement.Body)
+		c.IndentedJSON(http.StatusCreated, announcement)
+	}
+}
+
+func PutAnnouncement(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		announcementExist, err := GetAnnouncementById(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve announcement."})
+			return
+		}
+		var au AnnouncementUpdate
+		if err := c.ShouldBindJSON(&au); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		if au.Title != nil {
+			announcementExist.Title = *au.Title
+		}
+		if au.Body != nil {
+			announcementExist.Body = *au.Body
+		}
+		if au.Pinned != nil {
+			announcementExist.Pinned = *au.Pinned
+		}
+		// 0 / "" resets the audience to everyone
+		if au.SpotTypeID != nil && *au.SpotTypeID == 0 {
+			announcementExist.SpotTypeID = nil
+		} else if au.SpotTypeID != nil {
+			if err := checkSpot(db, int(*au.SpotTypeID), false); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Bad Spottype."})
+				return
+			}
+			announcementExist.SpotTypeID = au.SpotTypeID
+		}
+		if au.UserType != nil && *au.UserType == "" {
+			announcementExist.UserType = nil
+		} else if au.UserType != nil {
+			announcementExist.UserType = au.UserType
+		}
+
+		db.Save(&announcementExist)
+
+		if au.SendEmail {
+			if _, err := sendAnnouncementMails(db, &announcementExist); err != nil {
+				fmt.Println("Error was ", err.Error())
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Announcement was saved, but the emails could not be sent"})
+				return
+			}
+		}
+		announcementExist.BodyHTML = util.RenderMarkdown(announcementExist.Body)
+		c.JSON(http.StatusOK, announcementExist)
+	}
+}
+
+func DeleteAnnouncement(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		announcementExist, err := GetAnnouncementById(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve announcement."})
+			return
+		}
+		db.Delete(&announcementExist)
+		c.JSON(http.StatusOK, announcementExist)
+	}
+}
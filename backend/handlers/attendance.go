@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+type AttendanceUpdate struct {
+	// completed, no_show or excused, null to reset
+	Attendance *string `json:"attendance"`
+}
+
+type AttendanceOut struct {
+	User       models.UserShortResponse `json:"user"`
+	Attendance *string                  `json:"attendance"`
+}
+
+type NoShowOut struct {
+	User    models.UserShortResponse `json:"user"`
+	NoShows int                      `json:"noShows"`
+	Shifts  []string                 `json:"shifts"`
+}
+
+func validAttendance(attendance string) bool {
+	return attendance == models.AttendanceCompleted || attendance == models.AttendanceNoShow || attendance == models.AttendanceExcused
+}
+
+// SetAttendance records whether a user did their shift. Completed and no-show can only be set once the shift started.
+func SetAttendance(db *gorm.DB, shift models.Shift, userID uint, attendance *string, setBy uint) error {
+	if attendance != nil {
+		if !validAttendance(*attendance) {
+			return errors.New("attendance must be one of [completed, no_show, excused]")
+		}
+		started := shift.StartTime == nil || !shift.StartTime.After(time.Now())
+		if *attendance != models.AttendanceExcused && !started {
+			return errors.New("the shift did not start yet")
+		}
+	}
+	now := time.Now()
+	result := db.Model(&models.ShiftUser{}).Where("shift_id = ? AND user_id = ?", shift.ID, userID).
+		Updates(map[string]interface{}{"attendance": attendance, "attendance_set_at": &now, "attendance_set_by": setBy})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("user is not part of this shift (yet)")
+	}
+	return nil
+}
+
+// ##########
+// Handlers
+// ##########
+
+// HandleGetShiftAttendance lists the users of a shift with their attendance
+func HandleGetShiftAttendance(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shiftExist, err := GetShiftById(db, c.Param("shift_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		if !canManageTeam(c, shiftExist.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only see shifts of your own teams."})
+			return
+		}
+		var shiftUsers []models.ShiftUser
+		if err := db.Where("shift_id = ?", shiftExist.ID).Find(&shiftUsers).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		attendance := map[uint]*string{}
+		for _, su := range shiftUsers {
+			attendance[su.UserID] = su.Attendance
+		}
+		out := make([]AttendanceOut, len(shiftExist.Users))
+		for i, user := range shiftExist.Users {
+			out[i] = AttendanceOut{User: user.ToShortResponse(), Attendance: attendance[user.ID]}
+		}
+		c.IndentedJSON(http.StatusOK, out)
+	}
+}
+
+func HandleSetAttendance(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shiftExist, err := GetShiftById(db, c.Param("shift_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		if !canManageTeam(c, shiftExist.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only confirm shifts of your own teams."})
+			return
+		}
+		userIDUint, _ := strconv.ParseUint(c.Param("user_id"), 10, 32)
+		var au AttendanceUpdate
+		if err := c.ShouldBindJSON(&au); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		me, _ := c.Get("user_id")
+		if err := SetAttendance(db, shiftExist, uint(userIDUint), au.Attendance, me.(uint)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, au)
+	}
+}
+
+// GetNoShowReport lists all users that did not show up for at least one shift, the most no-shows first
+func GetNoShowReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var shiftUsers []models.ShiftUser
+		if err := db.Where("attendance = ?", models.AttendanceNoShow).Find(&shiftUsers).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		shiftIDs := []uint{}
+		userIDs := []uint{}
+		for _, su := range shiftUsers {
+			shiftIDs = append(shiftIDs, su.ShiftID)
+			userIDs = append(userIDs, su.UserID)
+		}
+		var shifts []models.Shift
+		var users []models.User
+		if err := db.Where("id IN ?", shiftIDs).Find(&shifts).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		if err := db.Where("id IN ?", userIDs).Order("nickname asc").Find(&users).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		shiftsByID := map[uint]models.Shift{}
+		for _, shift := range shifts {
+			shiftsByID[shift.ID] = shift
+		}
+
+		report := []NoShowOut{}
+		for _, user := range users {
+			entry := NoShowOut{User: user.ToShortResponse(), Shifts: []string{}}
+			for _, su := range shiftUsers {
+				if su.UserID == user.ID {
+					entry.NoShows++
+					entry.Shifts = append(entry.Shifts, shiftLabel(shiftsByID[su.ShiftID]))
+				}
+			}
+			report = append(report, entry)
+		}
+		// stable, so users with the same count stay sorted by nickname
+		sort.SliceStable(report, func(i, j int) bool { return report[i].NoShows > report[j].NoShows })
+		c.IndentedJSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+type AutoAssignOptions struct {
+	// only fill these shifts, all shifts with free seats if empty
+	ShiftIDs []uint `json:"shiftIds"`
+	// maximum number of shifts per user and day, including the ones they already have
+	MaxShiftsPerDay int `json:"maxShiftsPerDay"`
+}
+
+type ProposedAssignment struct {
+	ShiftID   uint       `json:"shiftId"`
+	ShiftName string     `json:"shiftName"`
+	StartTime *time.Time `json:"startTime"`
+	UserID    uint       `json:"userId"`
+	Nickname  string     `json:"nickname"`
+	Points    uint8      `json:"points"`
+}
+
+type AutoAssignProposal struct {
+	Assignments   []ProposedAssignment `json:"assignments"`
+	UnfilledSeats int                  `json:"unfilledSeats"`
+	// users that still owe points after the proposal
+	UsersBelowQuota int `json:"usersBelowQuota"`
+}
+
+type AutoAssignApply struct {
+	Assignments []ProposedAssignment `json:"assignments" binding:"required"`
+}
+
+const defaultMaxShiftsPerDay = 2
+
+// shifts starting in this time are night shifts, which get spread evenly
+const nightStartHour = 22
+const nightEndHour = 6
+
+// candidate is a user that still owes points, with everything the solver needs to know about them
+type candidate struct {
+	user         models.User
+	owed         int
+	shifts       []models.Shift
+	perDay       map[string]int
+	nights       int
+	assigned     int
+	availability []models.Availability
+	likes        map[uint]bool
+	dislikes     map[uint]bool
+	// verified qualifications
+	qualifications []uint
+}
+
+func shiftDayKey(shift models.Shift) string {
+	if shift.StartTime == nil {
+		return ""
+	}
+	return shift.StartTime.In(models.EventLocation()).Format("2006-01-02")
+}
+
+func isNightShift(shift models.Shift) bool {
+	if shift.StartTime == nil {
+		return false
+	}
+	hour := shift.StartTime.In(models.EventLocation()).Hour()
+	return hour >= nightStartHour || hour < nightEndHour
+}
+
+var arrivalWeekdays = map[string]time.Weekday{
+	"Fr": time.Friday,
+	"Sa": time.Saturday,
+	"So": time.Sunday,
+}
+
+// arrivesBefore checks the arrival day a user gave in their profile against the start of a shift
+func arrivesBefore(user models.User, shift models.Shift) bool {
+	if user.Arrival == nil || shift.StartTime == nil {
+		return true
+	}
+	arrival, known := arrivalWeekdays[*user.Arrival]
+	if !known {
+		return true
+	}
+	// the arrival is the first event day on that weekday
+	for _, day := range models.EventDays() {
+		if day.Date.Weekday() == arrival {
+			return shiftDayKey(shift) >= day.Date.Format("2006-01-02")
+		}
+	}
+	return true
+}
+
+// sundayShiftChoices are the answers for the clean-up on the last event day of users who stay for it,
+// everything else means they leave before it starts
+var sundayShiftChoices = []string{"früh", "spät"}
+
+// cleanupStartHour is when the clean-up on the last event day starts
+const cleanupStartHour = 11
+
+// leavesAfter checks the departure a user gave in their profile against the start of a shift:
+// users who can't help with the clean-up are gone before it starts
+func leavesAfter(user models.User, shift models.Shift) bool {
+	if user.SundayShift == nil || *user.SundayShift == "" || shift.StartTime == nil {
+		return true
+	}
+	if slices.Contains(sundayShiftChoices, *user.SundayShift) {
+		return true
+	}
+	days := models.EventDays()
+	if len(days) == 0 {
+		return true
+	}
+	last := days[len(days)-1].Date
+	cleanup := time.Date(last.Year(), last.Month(), last.Day(), cleanupStartHour, 0, 0, 0, models.EventLocation())
+	return shift.StartTime.Before(cleanup)
+}
+
+// isAvailable is true if the shift lies within one of the users availability windows
+func isAvailable(availability []models.Availability, shift models.Shift) bool {
+	if len(availability) == 0 || shift.StartTime == nil {
+		return true
+	}
+	end := *shift.StartTime
+	if shift.EndTime != nil {
+		end = *shift.EndTime
+	}
+	for _, a := range availability {
+		if !shift.StartTime.Before(a.StartTime) && !end.After(a.EndTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlapsAny(shifts []models.Shift, shift models.Shift) bool {
+	if shift.StartTime == nil || shift.EndTime == nil {
+		return false
+	}
+	for _, s := range shifts {
+		if s.StartTime == nil || s.EndTime == nil {
+			continue
+		}
+		if s.StartTime.Before(*shift.EndTime) && shift.StartTime.Before(*s.EndTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *candidate) canTake(shift models.Shift, maxPerDay int) bool {
+	if c.owed <= 0 {
+		return false
+	}
+	for _, u := range shift.Users {
+		if u.ID == c.user.ID {
+			return false
+		}
+	}
+	if shift.TeamID != nil && c.dislikes[*shift.TeamID] {
+		return false
+	}
+	if day := shiftDayKey(shift); day != "" && c.perDay[day] >= maxPerDay {
+		return false
+	}
+	if len(missingQualifications(shift, c.qualifications)) > 0 {
+		return false
+	}
+	return arrivesBefore(c.user, shift) && leavesAfter(c.user, shift) &&
+		isAvailable(c.availability, shift) && !overlapsAny(c.shifts, shift)
+}
+
+func (c *candidate) likesShift(shift models.Shift) bool {
+	return shift.TeamID != nil && c.likes[*shift.TeamID]
+}
+
+func (c *candidate) take(shift models.Shift) {
+	c.owed -= int(shift.Points)
+	c.shifts = append(c.shifts, shift)
+	if day := shiftDayKey(shift); day != "" {
+		c.perDay[day]++
+	}
+	if isNightShift(shift) {
+		c.nights++
+	}
+	c.assigned++
+}
+
+// loadCandidates collects all users below their quota together with their shifts, availability and preferences
+func loadCandidates(db *gorm.DB, allShifts []models.Shift) ([]*candidate, error) {
+	var users []models.User
+	if err := withShiftPoints(db).Preload("SpotType").Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byUser := map[uint]*candidate{}
+	candidates := []*candidate{}
+	for _, user := range users {
+		owed := user.PointsOwed()
+		if owed == nil || *owed == 0 {
+			continue
+		}
+		c := &candidate{user: user, owed: int(*owed), perDay: map[string]int{}, likes: map[uint]bool{}, dislikes: map[uint]bool{}}
+		byUser[user.ID] = c
+		candidates = append(candidates, c)
+	}
+
+	for _, shift := range allShifts {
+		for _, u := range shift.Users {
+			if c, ok := byUser[u.ID]; ok {
+				c.shifts = append(c.shifts, shift)
+				if day := shiftDayKey(shift); day != "" {
+					c.perDay[day]++
+				}
+				if isNightShift(shift) {
+					c.nights++
+				}
+			}
+		}
+	}
+
+	var availability []models.Availability
+	if err := db.Find(&availability).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range availability {
+		if c, ok := byUser[a.UserID]; ok {
+			c.availability = append(c.availability, a)
+		}
+	}
+
+	var preferences []models.ShiftPreference
+	if err := db.Where("team_id IS NOT NULL").Find(&preferences).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range preferences {
+		if c, ok := byUser[p.UserID]; ok {
+			if p.Likes {
+				c.likes[*p.TeamID] = true
+			} else {
+				c.dislikes[*p.TeamID] = true
+			}
+		}
+	}
+
+	var qualifications []models.UserQualification
+	if err := db.Where("verified").Find(&qualifications).Error; err != nil {
+		return nil, err
+	}
+	for _, q := range qualifications {
+		if c, ok := byUser[q.UserID]; ok {
+			c.qualifications = append(c.qualifications, q.QualificationID)
+		}
+	}
+	return candidates, nil
+}
+
+// ProposeAssignments fills the free seats of the shifts with users below their point quota.
+// It works greedily through the shifts by start time and picks for every seat the best fitting
+// user: someone who likes the team, has the fewest night shifts (for night shifts), owes the
+// most points and got the fewest shifts so far. Nothing is written to the DB.
+func ProposeAssignments(db *gorm.DB, opts AutoAssignOptions) (AutoAssignProposal, error) {
+	proposal := AutoAssignProposal{Assignments: []ProposedAssignment{}}
+	if opts.MaxShiftsPerDay <= 0 {
+		opts.MaxShiftsPerDay = defaultMaxShiftsPerDay
+	}
+
+	var allShifts []models.Shift
+	if err := db.Preload("Users").Preload("Qualifications").Order("start_time asc nulls last").Order("id").Find(&allShifts).Error; err != nil {
+		return proposal, err
+	}
+	candidates, err := loadCandidates(db, allShifts)
+	if err != nil {
+		return proposal, err
+	}
+
+	wanted := map[uint]bool{}
+	for _, id := range opts.ShiftIDs {
+		wanted[id] = true
+	}
+
+	for _, shift := range allShifts {
+		if len(wanted) > 0 && !wanted[shift.ID] {
+			continue
+		}
+		free := int(shift.HeadCount) - len(shift.Users)
+		for seat := 0; seat < free; seat++ {
+			eligible := []*candidate{}
+			for _, c := range candidates {
+				if c.canTake(shift, opts.MaxShiftsPerDay) {
+					eligible = append(eligible, c)
+				}
+			}
+			if len(eligible) == 0 {
+				proposal.UnfilledSeats += free - seat
+				break
+			}
+			night := isNightShift(shift)
+			sort.SliceStable(eligible, func(i, j int) bool {
+				a, b := eligible[i], eligible[j]
+				if a.likesShift(shift) != b.likesShift(shift) {
+					return a.likesShift(shift)
+				}
+				if night && a.nights != b.nights {
+					return a.nights < b.nights
+				}
+				if a.owed != b.owed {
+					return a.owed > b.owed
+				}
+				return a.assigned < b.assigned
+			})
+
+			chosen := eligible[0]
+			chosen.take(shift)
+			// the shift now counts the chosen user as well
+			shift.Users = append(shift.Users, &chosen.user)
+			proposal.Assignments = append(proposal.Assignments, ProposedAssignment{
+				ShiftID:   shift.ID,
+				ShiftName: shift.Name,
+				StartTime: shift.StartTime,
+				UserID:    chosen.user.ID,
+				Nickname:  chosen.user.Nickname,
+				Points:    shift.Points,
+			})
+		}
+	}
+
+	for _, c := range candidates {
+		if c.owed > 0 {
+			proposal.UsersBelowQuota++
+		}
+	}
+	return proposal, nil
+}
+
+// ApplyAssignments adds all assignments in one transaction, if one fails none are applied
+func ApplyAssignments(db *gorm.DB, assignments []ProposedAssignment) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, a := range assignments {
+			if err := AddUserToShift(tx, a.ShiftID, a.UserID, false, false); err != nil {
+				return fmt.Errorf("could not add user %d to shift %d: %s", a.UserID, a.ShiftID, err.Error())
+			}
+		}
+		return nil
+	})
+}
+
+// ##########
+// Handlers
+// ##########
+
+// HandleAutoAssignPreview returns a proposal for filling the free shifts without saving anything
+func HandleAutoAssignPreview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// an empty body proposes assignments for all shifts
+		var opts AutoAssignOptions
+		if err := c.ShouldBindJSON(&opts); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		proposal, err := ProposeAssignments(db, opts)
+		if err != nil {
+			fmt.Println(err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, proposal)
+	}
+}
+
+// HandleAutoAssignApply saves a (previewed) list of assignments
+func HandleAutoAssignApply(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var apply AutoAssignApply
+		if err := c.ShouldBindJSON(&apply); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if err := ApplyAssignments(db, apply.Assignments); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d Schichten wurden verteilt", len(apply.Assignments))})
+	}
+}
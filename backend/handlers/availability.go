@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+type AvailabilityWindow struct {
+	StartTime time.Time `json:"startTime" binding:"required"`
+	EndTime   time.Time `json:"endTime" binding:"required"`
+}
+
+type PreferenceIn struct {
+	TeamID *uint `json:"teamId"`
+	Likes  bool  `json:"likes"`
+}
+
+type AvailabilityInOut struct {
+	Availability []AvailabilityWindow `json:"availability"`
+	Preferences  []PreferenceIn       `json:"preferences"`
+}
+
+type ShiftCandidate struct {
+	User       ShiftParticipant `json:"user"`
+	Likes      bool             `json:"likes"`
+	PointsOwed *uint16          `json:"pointsOwed"`
+}
+
+func loadAvailability(db *gorm.DB, userID uint) ([]models.Availability, []models.ShiftPreference, error) {
+	var availability []models.Availability
+	if err := db.Where("user_id = ?", userID).Order("start_time").Find(&availability).Error; err != nil {
+		return nil, nil, err
+	}
+	var preferences []models.ShiftPreference
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&preferences).Error; err != nil {
+		return nil, nil, err
+	}
+	return availability, preferences, nil
+}
+
+// shiftPreference returns whether the user likes (true) or dislikes (false) the shift, nil if they don't care
+func shiftPreference(preferences []models.ShiftPreference, shift models.Shift) *bool {
+	for _, p := range preferences {
+		if p.TeamID != nil && shift.TeamID != nil && *p.TeamID == *shift.TeamID {
+			likes := p.Likes
+			return &likes
+		}
+	}
+	return nil
+}
+
+// availabilityWarnings tells admins if a user does not want to or cannot do a shift
+func availabilityWarnings(db *gorm.DB, shift models.Shift, userID uint) []string {
+	warnings := []string{}
+	availability, preferences, err := loadAvailability(db, userID)
+	if err != nil {
+		return warnings
+	}
+	if !isAvailable(availability, shift) {
+		warnings = append(warnings, "the shift is outside of the availability of the user")
+	}
+	if likes := shiftPreference(preferences, shift); likes != nil && !*likes {
+		warnings = append(warnings, "the user does not like shifts of this team")
+	}
+	return warnings
+}
+
+// assignmentWarnings tells admins and leads everything that speaks against the user taking the shift,
+// they may assign them anyway
+func assignmentWarnings(db *gorm.DB, shift models.Shift, userID uint) []string {
+	warnings := append(availabilityWarnings(db, shift, userID), qualificationWarnings(db, shift, userID)...)
+	if err := checkSignupLimits(db, shift, userID); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	return warnings
+}
+
+// ##########
+// Handlers
+// ##########
+
+func GetMyAvailability(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		availability, preferences, err := loadAvailability(db, userId.(uint))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		out := AvailabilityInOut{
+			Availability: make([]AvailabilityWindow, len(availability)),
+			Preferences:  make([]PreferenceIn, len(preferences)),
+		}
+		for i, a := range availability {
+			out.Availability[i] = AvailabilityWindow{StartTime: a.StartTime, EndTime: a.EndTime}
+		}
+		for i, p := range preferences {
+			out.Preferences[i] = PreferenceIn{TeamID: p.TeamID, Likes: p.Likes}
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// PutMyAvailability replaces all availability windows and preferences of the current user
+func PutMyAvailability(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		me := userId.(uint)
+		var in AvailabilityInOut
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		availability := []models.Availability{}
+		for _, a := range in.Availability {
+			if !a.EndTime.After(a.StartTime) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "end time needs to be after the start time"})
+				return
+			}
+			availability = append(availability, models.Availability{UserID: me, StartTime: a.StartTime, EndTime: a.EndTime})
+		}
+		preferences := []models.ShiftPreference{}
+		seenTeams := map[uint]bool{}
+		for _, p := range in.Preferences {
+			if p.TeamID == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a preference needs a team"})
+				return
+			}
+			if seenTeams[*p.TeamID] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "only one preference per team"})
+				return
+			}
+			seenTeams[*p.TeamID] = true
+			var team models.Team
+			if err := db.First(&team, *p.TeamID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve team."})
+				return
+			}
+			preferences = append(preferences, models.ShiftPreference{UserID: me, TeamID: p.TeamID, Likes: p.Likes})
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ?", me).Delete(&models.Availability{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", me).Delete(&models.ShiftPreference{}).Error; err != nil {
+				return err
+			}
+			if len(availability) > 0 {
+				if err := tx.Create(&availability).Error; err != nil {
+					return err
+				}
+			}
+			if len(preferences) > 0 {
+				return tx.Create(&preferences).Error
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save availability"})
+			return
+		}
+		c.JSON(http.StatusOK, in)
+	}
+}
+
+// HandleGetShiftCandidates lists the users who are available and qualified for a shift and don't dislike it,
+// the ones who like it first
+func HandleGetShiftCandidates(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shiftExist, err := GetShiftById(db, c.Param("shift_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		if !canManageTeam(c, shiftExist.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only staff shifts of your own teams."})
+			return
+		}
+
+		var allShifts []models.Shift
+		if err := db.Preload("Users").Find(&allShifts).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		userShifts := map[uint][]models.Shift{}
+		for _, shift := range allShifts {
+			for _, u := range shift.Users {
+				userShifts[u.ID] = append(userShifts[u.ID], shift)
+			}
+		}
+
+		var users []models.User
+		if err := withShiftPoints(db).Preload("SpotType").Order("nickname asc").Find(&users).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		var availability []models.Availability
+		var preferences []models.ShiftPreference
+		if err := db.Find(&availability).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		if err := db.Find(&preferences).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		userAvailability := map[uint][]models.Availability{}
+		for _, a := range availability {
+			userAvailability[a.UserID] = append(userAvailability[a.UserID], a)
+		}
+		userPreferences := map[uint][]models.ShiftPreference{}
+		for _, p := range preferences {
+			userPreferences[p.UserID] = append(userPreferences[p.UserID], p)
+		}
+		var qualifications []models.UserQualification
+		if err := db.Where("verified").Find(&qualifications).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		userQualifications := map[uint][]uint{}
+		for _, q := range qualifications {
+			userQualifications[q.UserID] = append(userQualifications[q.UserID], q.QualificationID)
+		}
+
+		viewer := rosterViewer(c, db)
+		candidates := []ShiftCandidate{}
+		for _, user := range users {
+			inShift := false
+			for _, u := range shiftExist.Users {
+				if u.ID == user.ID {
+					inShift = true
+				}
+			}
+			if inShift || overlapsAny(userShifts[user.ID], shiftExist) || !arrivesBefore(user, shiftExist) || !leavesAfter(user, shiftExist) {
+				continue
+			}
+			if !isAvailable(userAvailability[user.ID], shiftExist) || len(missingQualifications(shiftExist, userQualifications[user.ID])) > 0 {
+				continue
+			}
+			likes := shiftPreference(userPreferences[user.ID], shiftExist)
+			if likes != nil && !*likes {
+				continue
+			}
+			candidates = append(candidates, ShiftCandidate{
+				User:       viewer.participant(shiftExist, &user),
+				Likes:      likes != nil && *likes,
+				PointsOwed: user.PointsOwed(),
+			})
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Likes && !candidates[j].Likes
+		})
+		c.IndentedJSON(http.StatusOK, candidates)
+	}
+}
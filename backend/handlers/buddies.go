@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"sfpr/models"
+)
+
+type BuddyCreate struct {
+	ToUserID uint `json:"toUserId" binding:"required"`
+}
+
+type BuddyOut struct {
+	ID        uint             `json:"id"`
+	Shift     ShiftOut         `json:"shift"`
+	FromUser  ShiftParticipant `json:"fromUser"`
+	ToUser    ShiftParticipant `json:"toUser"`
+	Status    string           `json:"status"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+var (
+	ErrNoBuddySeats = errors.New("this shift has no two free seats left")
+	ErrSignupClosed = errors.New("the roster for this shift is final, please ask an admin")
+	ErrBuddyNotOpen = errors.New("this buddy request is not open anymore")
+	ErrNotYourBuddy = errors.New("this buddy request is meant for someone else")
+
+	// rolls back the trial sign-up when a buddy request is created
+	errBuddyTrial = errors.New("buddy trial sign-up")
+)
+
+func BuddyToOut(buddy models.ShiftBuddy, viewer RosterViewer) BuddyOut {
+	out := BuddyOut{
+		ID:        buddy.ID,
+		Status:    buddy.Status,
+		CreatedAt: buddy.CreatedAt,
+	}
+	shift := models.Shift{}
+	if buddy.Shift != nil {
+		shift = *buddy.Shift
+		out.Shift = ShiftToOut(shift, viewer)
+	}
+	if buddy.FromUser != nil {
+		out.FromUser = viewer.participant(shift, buddy.FromUser)
+	}
+	if buddy.ToUser != nil {
+		out.ToUser = viewer.participant(shift, buddy.ToUser)
+	}
+	return out
+}
+
+// AddBuddiesToShift signs up both users for the shift in one transaction, if the shift can't
+// take both of them neither is added
+func AddBuddiesToShift(db *gorm.DB, shiftID, fromUserID, toUserID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		shift, err := lockShift(tx, shiftID)
+		if err != nil {
+			return err
+		}
+		if shift.SelfSignupClosed() {
+			return ErrSignupClosed
+		}
+		var assigned int64
+		if err := tx.Table("shift_users").Where("shift_id = ?", shiftID).Count(&assigned).Error; err != nil {
+			return err
+		}
+		if int64(shift.HeadCount)-assigned < 2 {
+			return ErrNoBuddySeats
+		}
+		if err := AddUserToShift(tx, shiftID, fromUserID, true, false); err != nil {
+			return err
+		}
+		return AddUserToShift(tx, shiftID, toUserID, true, false)
+	})
+}
+
+// checkBuddySignup tells whether both users could sign up for the shift right now, without signing them up
+func checkBuddySignup(db *gorm.DB, shiftID, fromUserID, toUserID uint) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := AddBuddiesToShift(tx, shiftID, fromUserID, toUserID); err != nil {
+			return err
+		}
+		return errBuddyTrial
+	})
+	if errors.Is(err, errBuddyTrial) {
+		return nil
+	}
+	return err
+}
+
+// ConfirmBuddy lets the invited friend accept a buddy request, which takes both seats at once
+func ConfirmBuddy(db *gorm.DB, buddyID uint, userID uint) (models.ShiftBuddy, error) {
+	var buddy models.ShiftBuddy
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&buddy, buddyID).Error; err != nil {
+			return err
+		}
+		if buddy.Status != models.BuddyOpen {
+			return ErrBuddyNotOpen
+		}
+		if buddy.ToUserID != userID {
+			return ErrNotYourBuddy
+		}
+		if err := AddBuddiesToShift(tx, buddy.ShiftID, buddy.FromUserID, buddy.ToUserID); err != nil {
+			return err
+		}
+		buddy.Status = models.BuddyConfirmed
+		return tx.Save(&buddy).Error
+	})
+	return buddy, err
+}
+
+// ##########
+// Handlers
+// ##########
+
+// HandleCreateBuddy asks a friend to do a shift together with the current user
+func HandleCreateBuddy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		me := userId.(uint)
+
+		var bc BuddyCreate
+		if err := c.ShouldBindJSON(&bc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if bc.ToUserID == me {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot be your own buddy"})
+			return
+		}
+		shiftExist, err := GetShiftById(db, c.Param("shift_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		var toUser models.User
+		if err := db.First(&toUser, bc.ToUserID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve user."})
+			return
+		}
+
+		var openBuddies int64
+		db.Model(&models.ShiftBuddy{}).Where("shift_id = ? AND from_user_id = ? AND status = ?", shiftExist.ID, me, models.BuddyOpen).Count(&openBuddies)
+		if openBuddies > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "you already asked someone for this shift"})
+			return
+		}
+		// fail early if the two could not sign up together anyway
+		if err := checkBuddySignup(db, shiftExist.ID, me, toUser.ID); err != nil {
+			c.JSON(shiftErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		buddy := models.ShiftBuddy{
+			ShiftID:    shiftExist.ID,
+			FromUserID: me,
+			ToUserID:   toUser.ID,
+			Status:     models.BuddyOpen,
+		}
+		if err := db.Create(&buddy).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create buddy request"})
+			return
+		}
+		if err := db.Preload("Shift.Users").Preload("Shift.Qualifications").Preload("FromUser").Preload("ToUser").First(&buddy, buddy.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load buddy request"})
+			return
+		}
+
+		notifyUsers([]models.User{toUser}, "Gemeinsame Schicht",
+			fmt.Sprintf("%s möchte die Schicht %s mit dir zusammen machen. Du kannst die Anfrage auf der Schichtseite bestätigen.", buddy.FromUser.Nickname, shiftLabel(*buddy.Shift)))
+		c.IndentedJSON(http.StatusCreated, BuddyToOut(buddy, rosterViewer(c, db)))
+	}
+}
+
+// HandleGetBuddies lists the open buddy requests of the current user and the ones waiting for their confirmation
+func HandleGetBuddies(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		var buddies []models.ShiftBuddy
+		query := db.Preload("Shift.Users").Preload("Shift.Qualifications").Preload("FromUser").Preload("ToUser").
+			Where("status = ?", models.BuddyOpen).
+			Where("from_user_id = ? OR to_user_id = ?", userId, userId)
+		if err := query.Order("created_at asc").Find(&buddies).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		viewer := rosterViewer(c, db)
+		buddiesOut := make([]BuddyOut, len(buddies))
+		for i, buddy := range buddies {
+			buddiesOut[i] = BuddyToOut(buddy, viewer)
+		}
+		c.IndentedJSON(http.StatusOK, buddiesOut)
+	}
+}
+
+func HandleConfirmBuddy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		buddyIDUint, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+
+		buddy, err := ConfirmBuddy(db, uint(buddyIDUint), userId.(uint))
+		if err != nil {
+			c.JSON(shiftErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Preload("Shift.Users").Preload("Shift.Qualifications").Preload("FromUser").Preload("ToUser").First(&buddy, buddy.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load buddy request"})
+			return
+		}
+
+		notifyUsers([]models.User{*buddy.FromUser}, "Gemeinsame Schicht",
+			fmt.Sprintf("%s hat bestätigt, ihr seid jetzt beide für die Schicht %s eingetragen.", buddy.ToUser.Nickname, shiftLabel(*buddy.Shift)))
+		c.JSON(http.StatusOK, BuddyToOut(buddy, rosterViewer(c, db)))
+	}
+}
+
+// HandleDeleteBuddy withdraws an open buddy request, or declines it if it was meant for the current user
+func HandleDeleteBuddy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		me := userId.(uint)
+		var buddy models.ShiftBuddy
+		if err := db.Preload("Shift").Preload("FromUser").Preload("ToUser").First(&buddy, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve buddy request."})
+			return
+		}
+		if buddy.FromUserID != me && buddy.ToUserID != me {
+			c.JSON(http.StatusForbidden, gin.H{"error": "this is not your buddy request"})
+			return
+		}
+		if buddy.Status != models.BuddyOpen {
+			c.JSON(http.StatusConflict, gin.H{"error": ErrBuddyNotOpen.Error()})
+			return
+		}
+		if buddy.ToUserID == me {
+			buddy.Status = models.BuddyDeclined
+			notifyUsers([]models.User{*buddy.FromUser}, "Gemeinsame Schicht",
+				fmt.Sprintf("%s hat deine Anfrage für die Schicht %s abgelehnt.", buddy.ToUser.Nickname, shiftLabel(*buddy.Shift)))
+		} else {
+			buddy.Status = models.BuddyCancelled
+		}
+		db.Model(&buddy).Update("status", buddy.Status)
+		c.JSON(http.StatusOK, buddy)
+	}
+}
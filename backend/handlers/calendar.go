@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+	"sfpr/util"
+)
+
+// remind people one hour before their shift starts
+const calendarAlarmMinutes = 60
+
+type CalendarOut struct {
+	URL string `json:"url"`
+}
+
+func calendarURL(token string) string {
+	return fmt.Sprintf("%s/api/calendar/%s.ics", util.ApiBaseURL(), token)
+}
+
+// setCalendarToken gives the user a new secret calendar token, which invalidates the old URL
+func setCalendarToken(db *gorm.DB, user *models.User) error {
+	token := randomString(40)
+	user.CalendarToken = &token
+	return db.Model(user).Update("calendar_token", token).Error
+}
+
+// shiftCalendarEvents turns the shifts of a user into calendar events
+func shiftCalendarEvents(shifts []models.Shift) []util.CalendarEvent {
+	events := []util.CalendarEvent{}
+	for _, shift := range shifts {
+		if shift.StartTime == nil {
+			continue
+		}
+		description := fmt.Sprintf("%d Punkt(e)", shift.Points)
+		if shift.Description != nil {
+			description = *shift.Description + "\n\n" + description
+		}
+		events = append(events, util.CalendarEvent{
+			UID:          fmt.Sprintf("shift-%d@schoenfeld.fun", shift.ID),
+			Summary:      "Schicht: " + shift.Name,
+			Description:  description,
+			Start:        *shift.StartTime,
+			End:          shift.EndTime,
+			AlarmMinutes: calendarAlarmMinutes,
+		})
+	}
+	return events
+}
+
+// eventDayCalendarEvents adds an all day event for every day of the event
+func eventDayCalendarEvents() []util.CalendarEvent {
+	events := []util.CalendarEvent{}
+	for _, day := range models.EventDays() {
+		events = append(events, util.CalendarEvent{
+			UID:     fmt.Sprintf("day-%s@schoenfeld.fun", day.Date.Format("20060102")),
+			Summary: "Schönfeld (" + day.Name + ")",
+			Start:   day.Date,
+			AllDay:  true,
+		})
+	}
+	return events
+}
+
+// ##########
+// Handlers
+// ##########
+
+// GetMyCalendar returns the secret calendar URL of the current user and creates one if needed
+func GetMyCalendar(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		var userExist models.User
+		if err := db.First(&userExist, userId).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User is not in DB."})
+			return
+		}
+		if userExist.CalendarToken == nil {
+			if err := setCalendarToken(db, &userExist); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar"})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, CalendarOut{URL: calendarURL(*userExist.CalendarToken)})
+	}
+}
+
+// ResetMyCalendar revokes the old calendar URL and returns a new one
+func ResetMyCalendar(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		var userExist models.User
+		if err := db.First(&userExist, userId).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User is not in DB."})
+			return
+		}
+		if err := setCalendarToken(db, &userExist); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar"})
+			return
+		}
+		c.JSON(http.StatusOK, CalendarOut{URL: calendarURL(*userExist.CalendarToken)})
+	}
+}
+
+// DeleteMyCalendar revokes the calendar URL without creating a new one
+func DeleteMyCalendar(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		if err := db.Model(&models.User{}).Where("id = ?", userId).Update("calendar_token", nil).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete calendar"})
+			return
+		}
+		c.JSON(http.StatusOK, "ok")
+	}
+}
+
+// GetCalendarFeed serves the iCalendar feed of a user. It is public, the token is the secret.
+func GetCalendarFeed(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSuffix(c.Param("token"), ".ics")
+		if token == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown calendar"})
+			return
+		}
+		var userExist models.User
+		if err := db.First(&userExist, "calendar_token = ?", token).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown calendar"})
+			return
+		}
+
+		var shifts []models.Shift
+		query := db.Joins("join shift_users on shifts.id = shift_users.shift_id").Where("shift_users.user_id = ?", userExist.ID)
+		if err := query.Order("shifts.start_time").Find(&shifts).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		events := append(eventDayCalendarEvents(), shiftCalendarEvents(shifts)...)
+
+		c.Header("Content-Disposition", `inline; filename="schoenfeld.ics"`)
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(util.ICalendar("Schönfeld – "+userExist.Nickname, events)))
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+type ShiftCategoryCreate struct {
+	Name        string  `json:"name" binding:"required"`
+	Color       *string `json:"color"`
+	Description *string `json:"description"`
+}
+
+type ShiftCategoryUpdate struct {
+	Name        *string `json:"name"`
+	Color       *string `json:"color"`
+	Description *string `json:"description"`
+}
+
+type ShiftLocationCreate struct {
+	Name         string  `json:"name" binding:"required"`
+	Description  *string `json:"description"`
+	SitePlanArea *string `json:"sitePlanArea"`
+}
+
+type ShiftLocationUpdate struct {
+	Name         *string `json:"name"`
+	Description  *string `json:"description"`
+	SitePlanArea *string `json:"sitePlanArea"`
+}
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ##########
+// Handlers
+// ##########
+
+func GetShiftCategories(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var categories []models.ShiftCategory
+		if err := db.Order("name asc").Find(&categories).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, categories)
+	}
+}
+
+func CreateShiftCategory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var cc ShiftCategoryCreate
+		if err := c.ShouldBindJSON(&cc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		category := models.ShiftCategory{Name: cc.Name, Color: "#888888", Description: cc.Description}
+		if cc.Color != nil {
+			if !colorPattern.MatchString(*cc.Color) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "The colour has to look like #ff8800"})
+				return
+			}
+			category.Color = *cc.Color
+		}
+		if err := db.Create(&category).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+			return
+		}
+		c.IndentedJSON(http.StatusCreated, category)
+	}
+}
+
+func PutShiftCategory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var category models.ShiftCategory
+		if err := db.First(&category, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve category."})
+			return
+		}
+		var cu ShiftCategoryUpdate
+		if err := c.ShouldBindJSON(&cu); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if cu.Name != nil {
+			category.Name = *cu.Name
+		}
+		if cu.Color != nil {
+			if !colorPattern.MatchString(*cu.Color) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "The colour has to look like #ff8800"})
+				return
+			}
+			category.Color = *cu.Color
+		}
+		if cu.Description != nil {
+			category.Description = cu.Description
+		}
+		if err := db.Save(&category).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save category"})
+			return
+		}
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+// DeleteShiftCategory removes the category, its shifts stay without one
+func DeleteShiftCategory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var category models.ShiftCategory
+		if err := db.First(&category, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve category."})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Shift{}).Where("category_id = ?", category.ID).Update("category_id", nil).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&category).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+			return
+		}
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func GetShiftLocations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var locations []models.ShiftLocation
+		if err := db.Order("name asc").Find(&locations).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, locations)
+	}
+}
+
+func CreateShiftLocation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var lc ShiftLocationCreate
+		if err := c.ShouldBindJSON(&lc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		location := models.ShiftLocation{Name: lc.Name, Description: lc.Description, SitePlanArea: lc.SitePlanArea}
+		if err := db.Create(&location).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create location"})
+			return
+		}
+		c.IndentedJSON(http.StatusCreated, location)
+	}
+}
+
+func PutShiftLocation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var location models.ShiftLocation
+		if err := db.First(&location, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve location."})
+			return
+		}
+		var lu ShiftLocationUpdate
+		if err := c.ShouldBindJSON(&lu); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if lu.Name != nil {
+			location.Name = *lu.Name
+		}
+		if lu.Description != nil {
+			location.Description = lu.Description
+		}
+		if lu.SitePlanArea != nil {
+			location.SitePlanArea = lu.SitePlanArea
+		}
+		if err := db.Save(&location).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save location"})
+			return
+		}
+		c.JSON(http.StatusOK, location)
+	}
+}
+
+// DeleteShiftLocation removes the location, its shifts stay without one
+func DeleteShiftLocation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var location models.ShiftLocation
+		if err := db.First(&location, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve location."})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Shift{}).Where("location_id = ?", location.ID).Update("location_id", nil).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&location).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+			return
+		}
+		c.JSON(http.StatusOK, location)
+	}
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -12,7 +14,9 @@ import (
 	"sfpr/util"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -50,6 +54,22 @@ func sendReq(router *gin.Engine, method string, path string, body *string, token
 	return w.Code, res_body
 }
 
+func uploadCSV(router *gin.Engine, path string, content string, token *string) (int, []byte) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("file", "shifts.csv")
+	part.Write([]byte(content))
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", path, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+*token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	res_body, _ := io.ReadAll(w.Body)
+	return w.Code, res_body
+}
+
 func umGeneric(resBody []byte) map[string]interface{} {
 	var response map[string]interface{}
 	if err := json.Unmarshal(resBody, &response); err != nil {
@@ -87,7 +107,25 @@ func TestMain(m *testing.M) {
 
 	// Create tables, seed data, etc.
 	// Migrate the schema
-	err := testDB.AutoMigrate(&models.User{}, &models.SpotType{}, &models.Shift{})
+	err := testDB.AutoMigrate(
+		&models.User{},
+		&models.SpotType{},
+		&models.Shift{},
+		&models.ShiftUser{},
+		&models.ShiftStandby{},
+		&models.ShiftTemplate{},
+		&models.Announcement{},
+		&models.ShiftSwap{},
+		&models.ShiftNotification{},
+		&models.Team{},
+		&models.Availability{},
+		&models.ShiftPreference{},
+		&models.Qualification{},
+		&models.UserQualification{},
+		&models.ShiftCategory{},
+		&models.ShiftLocation{},
+		&models.ShiftBuddy{},
+	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
@@ -440,7 +478,7 @@ func TestShifts(t *testing.T) {
 	// error since user cannot be added another time
 	code, body = sendReq(router, "POST", "/api/admin/shifts/"+stid+"/user/"+userId, nil, &token)
 	bodyMap = umGeneric(body)
-	checkRes(t, 400, code, bodyMap)
+	checkRes(t, 409, code, bodyMap)
 
 	// check shifts, which should include user
 	code, body = sendReq(router, "GET", "/api/admin/shifts/", nil, &token)
@@ -457,7 +495,7 @@ func TestShifts(t *testing.T) {
 	// try adding another user to shift but fail since shift is full
 	code, body = sendReq(router, "POST", "/api/admin/shifts/"+stid+"/user/"+adminIdStr, nil, &token)
 	bodyMap = umGeneric(body)
-	checkRes(t, 400, code, bodyMap)
+	checkRes(t, 409, code, bodyMap)
 
 	// delete User from Shift
 	code, body = sendReq(router, "DELETE", "/api/admin/shifts/"+stid+"/user/"+userId, nil, &token)
@@ -492,3 +530,1604 @@ func TestShifts(t *testing.T) {
 	bodyMap = umGeneric(body)
 	checkRes(t, 200, code, bodyMap)
 }
+
+func TestAnnouncements(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+
+	// spot type to filter the audience with
+	code, body := sendReq(router, "POST", "/api/admin/spots/", util.StrPtr(`{"name": "zelt", "price": 76, "limit":20}`), &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	stid := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	b := `{"title": "Parken", "body": "Bitte **nicht** auf der Wiese parken"}`
+	code, body = sendReq(router, "POST", "/api/admin/announcements/", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+
+	b = `{"title": "Mitbringen", "body": "Handtuch!", "pinned": true, "sendEmail": true}`
+	code, body = sendReq(router, "POST", "/api/admin/announcements/", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	// email sending is disabled in the tests, so nothing was sent
+	assert.Nil(t, bodyMap["emailSentAt"])
+
+	b = fmt.Sprintf(`{"title": "Nur Zelte", "body": "Iso nicht vergessen", "spotTypeId": %s}`, stid)
+	code, body = sendReq(router, "POST", "/api/admin/announcements/", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+
+	// missing title
+	b = `{"body": "blub"}`
+	code, _ = sendReq(router, "POST", "/api/admin/announcements/", &b, &token)
+	assert.Equal(t, 400, code)
+
+	// admin has no spot type, so the tent announcement is hidden, pinned comes first
+	code, body = sendReq(router, "GET", "/api/user/announcements?page=1&pageSize=1", nil, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, float64(2), bodyMap["total"])
+	items := bodyMap["items"].([]interface{})
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "Mitbringen", items[0].(map[string]interface{})["title"])
+
+	b = fmt.Sprintf(`{"spotTypeId": %s}`, stid)
+	code, _ = sendReq(router, "PUT", "/api/user/me", &b, &token)
+	assert.Equal(t, 200, code)
+	code, body = sendReq(router, "GET", "/api/user/announcements", nil, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, float64(3), bodyMap["total"])
+
+	code, _ = sendReq(router, "GET", "/api/user/announcements?pageSize=1000", nil, &token)
+	assert.Equal(t, 400, code)
+}
+
+func TestShiftOverlap(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	adminIdStr := strconv.FormatUint(uint64(AdminID), 10)
+
+	// end before start is rejected
+	b := `{"name": "Bar", "headCount": 2, "startTime": "2025-06-06T20:00:00+02:00", "endTime": "2025-06-06T18:00:00+02:00"}`
+	code, _ := sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	assert.Equal(t, 400, code)
+
+	b = `{"name": "Bar", "headCount": 2, "startTime": "2025-06-06T18:00:00+02:00", "endTime": "2025-06-06T20:00:00+02:00"}`
+	code, body := sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	barId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	b = `{"name": "Kochen", "headCount": 2, "startTime": "2025-06-06T19:00:00+02:00", "endTime": "2025-06-06T21:00:00+02:00"}`
+	code, body = sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	kitchenId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	// back to back is fine
+	b = `{"name": "Abwasch", "headCount": 2, "startTime": "2025-06-06T20:00:00+02:00", "endTime": "2025-06-06T22:00:00+02:00"}`
+	code, body = sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	dishesId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+barId+"/me", nil, &token)
+	checkRes(t, 200, code, umGeneric(body))
+
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+kitchenId+"/me", nil, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 400, code, bodyMap)
+	assert.Contains(t, bodyMap["error"], "Bar")
+
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+dishesId+"/me", nil, &token)
+	checkRes(t, 200, code, umGeneric(body))
+
+	// admins can force it
+	code, body = sendReq(router, "POST", "/api/admin/shifts/"+kitchenId+"/user/"+adminIdStr, nil, &token)
+	checkRes(t, 400, code, umGeneric(body))
+	code, body = sendReq(router, "POST", "/api/admin/shifts/"+kitchenId+"/user/"+adminIdStr+"?force=true", nil, &token)
+	checkRes(t, 200, code, umGeneric(body))
+
+	code, body = sendReq(router, "GET", "/api/admin/shifts/conflicts", nil, &token)
+	assert.Equal(t, 200, code)
+	var conflicts []ShiftConflict
+	if err := json.Unmarshal(body, &conflicts); err != nil {
+		t.Errorf("Bad Conflicts (list) Response")
+	}
+	// Kochen overlaps with Bar and Abwasch
+	assert.Equal(t, 2, len(conflicts))
+	assert.Equal(t, AdminID, conflicts[0].UserID)
+}
+
+func TestShiftPointsQuota(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+
+	b := `{"name": "Haus", "price": 200, "limit": 20, "requiredPoints": 4}`
+	code, body := sendReq(router, "POST", "/api/admin/spots/", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	stid := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	b = fmt.Sprintf(`{"spotTypeId": %s}`, stid)
+	code, body = sendReq(router, "PUT", "/api/user/me", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, float64(0), bodyMap["shiftPoints"])
+	assert.Equal(t, float64(4), bodyMap["pointsOwed"])
+
+	b = `{"name": "Kochen", "headCount": 2, "points": 3}`
+	code, body = sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	shiftId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &token)
+	assert.Equal(t, 200, code)
+
+	code, body = sendReq(router, "GET", "/api/user/me", nil, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, float64(1), bodyMap["pointsOwed"])
+	assert.Equal(t, float64(200), bodyMap["amountToPay"])
+
+	code, body = sendReq(router, "GET", "/api/admin/users/quota", nil, &token)
+	assert.Equal(t, 200, code)
+	var usersList []models.UserResponse
+	if err := json.Unmarshal(body, &usersList); err != nil {
+		t.Errorf("Bad Users (list) Response")
+	}
+	assert.Equal(t, 1, len(usersList))
+	assert.Equal(t, AdminID, usersList[0].ID)
+
+	// missing points cost extra after the deadline
+	deadline := time.Now().Add(-time.Hour)
+	models.SetPointsDeadline(&deadline)
+	models.SetMissingPointsFee(10)
+	defer models.SetPointsDeadline(nil)
+	defer models.SetMissingPointsFee(0)
+
+	code, body = sendReq(router, "GET", "/api/user/me", nil, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, float64(210), bodyMap["amountToPay"])
+}
+
+// createActiveUser adds an activated user directly to the DB and returns it with a valid token
+func createActiveUser(db *gorm.DB, email string, nickname string) (models.User, string) {
+	user := models.User{
+		Username:    util.StrPtr(email),
+		Type:        "reg",
+		Nickname:    nickname,
+		FullName:    util.StrPtr(nickname + " Person"),
+		IsActivated: true,
+	}
+	db.Create(&user)
+	return user, getToken(email)
+}
+
+func TestShiftSwaps(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	friend, friendToken := createActiveUser(tx, "friend@blub.io", "friend")
+	stranger, strangerToken := createActiveUser(tx, "stranger@blub.io", "stranger")
+
+	b := `{"name": "Bar", "headCount": 1}`
+	code, body := sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	shiftId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	// cannot offer a shift you are not in
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/swap", nil, &token)
+	assert.Equal(t, 400, code)
+
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &token)
+	assert.Equal(t, 200, code)
+
+	// offer it to the friend only
+	b = fmt.Sprintf(`{"toUserId": %d}`, friend.ID)
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/swap", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	swapId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	// stranger does not see it and cannot take it
+	code, body = sendReq(router, "GET", "/api/user/swaps", nil, &strangerToken)
+	assert.Equal(t, 200, code)
+	var swaps []SwapOut
+	if err := json.Unmarshal(body, &swaps); err != nil {
+		t.Errorf("Bad Swaps (list) Response")
+	}
+	assert.Equal(t, 0, len(swaps))
+	code, _ = sendReq(router, "POST", "/api/user/swaps/"+swapId+"/accept", nil, &strangerToken)
+	assert.Equal(t, 400, code)
+
+	// the friend sees it, but not the hidden full name of whoever offers it
+	code, body = sendReq(router, "GET", "/api/user/swaps", nil, &friendToken)
+	assert.Equal(t, 200, code)
+	if err := json.Unmarshal(body, &swaps); err != nil {
+		t.Errorf("Bad Swaps (list) Response")
+	}
+	assert.Equal(t, 1, len(swaps))
+	assert.Nil(t, swaps[0].FromUser.FullName)
+
+	code, body = sendReq(router, "POST", "/api/user/swaps/"+swapId+"/accept", nil, &friendToken)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, "accepted", bodyMap["status"])
+
+	shift, _ := GetShiftById(tx, shiftId)
+	assert.Equal(t, 1, len(shift.Users))
+	assert.Equal(t, friend.ID, shift.Users[0].ID)
+
+	// public offer, picked up by the stranger
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/swap", nil, &friendToken)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	swapId = strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	code, body = sendReq(router, "POST", "/api/user/swaps/"+swapId+"/accept", nil, &strangerToken)
+	checkRes(t, 200, code, umGeneric(body))
+	shift, _ = GetShiftById(tx, shiftId)
+	assert.Equal(t, stranger.ID, shift.Users[0].ID)
+
+	// accepting twice does not work
+	code, _ = sendReq(router, "POST", "/api/user/swaps/"+swapId+"/accept", nil, &token)
+	assert.Equal(t, 400, code)
+}
+
+func TestCalendarFeed(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+
+	b := `{"name": "Bar", "headCount": 2, "day": "Freitag", "startTime": "2025-06-06T18:00:00+02:00", "endTime": "2025-06-06T20:00:00+02:00"}`
+	code, body := sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	shiftId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &token)
+	assert.Equal(t, 200, code)
+
+	code, body = sendReq(router, "GET", "/api/user/me/calendar", nil, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	url := bodyMap["url"].(string)
+	path := url[strings.Index(url, "/api/"):]
+
+	code, body = sendReq(router, "GET", path, nil, nil)
+	assert.Equal(t, 200, code)
+	ics := string(body)
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n"))
+	assert.Contains(t, ics, "SUMMARY:Schicht: Bar\r\n")
+	assert.Contains(t, ics, "DTSTART:20250606T160000Z\r\n")
+	assert.Contains(t, ics, "DTEND:20250606T180000Z\r\n")
+	assert.Contains(t, ics, "DTSTART;VALUE=DATE:20250606\r\n")
+
+	// a new URL revokes the old one
+	code, body = sendReq(router, "POST", "/api/user/me/calendar", nil, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.NotEqual(t, url, bodyMap["url"])
+	code, _ = sendReq(router, "GET", path, nil, nil)
+	assert.Equal(t, 404, code)
+
+	code, _ = sendReq(router, "DELETE", "/api/user/me/calendar", nil, &token)
+	assert.Equal(t, 200, code)
+	newUrl := bodyMap["url"].(string)
+	code, _ = sendReq(router, "GET", newUrl[strings.Index(newUrl, "/api/"):], nil, nil)
+	assert.Equal(t, 404, code)
+}
+
+func TestShiftReminders(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+
+	now := time.Now()
+	soon := now.Add(30 * time.Minute)
+	later := now.Add(5 * time.Hour)
+	user, _ := createActiveUser(tx, "early@blub.io", "early")
+
+	// starts soon, one of two people there
+	soonShift := models.Shift{Name: "Bar", HeadCount: 2, StartTime: &soon, Users: []*models.User{&user}}
+	tx.Create(&soonShift)
+	// only the 12h reminder is due
+	laterShift := models.Shift{Name: "Kochen", HeadCount: 1, StartTime: &later, Users: []*models.User{&user}}
+	tx.Create(&laterShift)
+
+	config := ReminderConfig{
+		Offsets:           []time.Duration{12 * time.Hour, time.Hour},
+		UnderstaffedAlert: time.Hour,
+	}
+	var admins int64
+	tx.Model(&models.User{}).Where("type = ?", "admin").Count(&admins)
+
+	// with email sending disabled nothing is sent or marked as sent
+	sent, err := SendShiftReminders(tx, config, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, sent)
+	var notifications int64
+	tx.Model(&models.ShiftNotification{}).Where("shift_id = ?", soonShift.ID).Count(&notifications)
+	assert.Equal(t, int64(0), notifications)
+
+	util.EmailsEnabled = true
+	defer func() { util.EmailsEnabled = false }()
+
+	// both reminders for the soon shift count as one mail
+	sent, err = SendShiftReminders(tx, config, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 2+int(admins), sent)
+
+	tx.Model(&models.ShiftNotification{}).Where("shift_id = ?", soonShift.ID).Count(&notifications)
+	assert.Equal(t, int64(3), notifications)
+
+	// nothing is sent twice
+	sent, err = SendShiftReminders(tx, config, now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, sent)
+
+	// 1h reminder of the later shift
+	sent, err = SendShiftReminders(tx, config, later.Add(-50*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, sent)
+}
+
+func TestTeamLeads(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	lead, leadToken := createActiveUser(tx, "lead@blub.io", "lead")
+	helper, helperToken := createActiveUser(tx, "helper@blub.io", "helper")
+
+	code, body := sendReq(router, "POST", "/api/admin/teams/", util.StrPtr(`{"name": "Bar"}`), &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	barId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+	code, body = sendReq(router, "POST", "/api/admin/teams/", util.StrPtr(`{"name": "Küche"}`), &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	kitchenId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	// not a lead yet
+	code, _ = sendReq(router, "GET", "/api/lead/teams", nil, &leadToken)
+	assert.Equal(t, 403, code)
+
+	code, body = sendReq(router, "POST", "/api/admin/teams/"+barId+"/leads/"+strconv.FormatUint(uint64(lead.ID), 10), nil, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, 1, len(bodyMap["leads"].([]interface{})))
+
+	code, body = sendReq(router, "GET", "/api/lead/teams", nil, &leadToken)
+	assert.Equal(t, 200, code)
+	var teams []TeamOut
+	if err := json.Unmarshal(body, &teams); err != nil {
+		t.Errorf("Bad Teams (list) Response")
+	}
+	assert.Equal(t, 1, len(teams))
+	assert.Equal(t, "Bar", teams[0].Name)
+
+	// only shifts in the own team
+	b := fmt.Sprintf(`{"name": "Theke", "headCount": 2, "teamId": %s}`, barId)
+	code, body = sendReq(router, "POST", "/api/lead/shifts/", &b, &leadToken)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	shiftId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	b = fmt.Sprintf(`{"name": "Kochen", "headCount": 2, "teamId": %s}`, kitchenId)
+	code, _ = sendReq(router, "POST", "/api/lead/shifts/", &b, &leadToken)
+	assert.Equal(t, 403, code)
+	code, _ = sendReq(router, "POST", "/api/lead/shifts/", util.StrPtr(`{"name": "Ohne", "headCount": 2}`), &leadToken)
+	assert.Equal(t, 403, code)
+
+	// cannot move the shift to another team
+	b = fmt.Sprintf(`{"teamId": %s}`, kitchenId)
+	code, _ = sendReq(router, "PUT", "/api/lead/shifts/"+shiftId, &b, &leadToken)
+	assert.Equal(t, 403, code)
+	code, _ = sendReq(router, "PUT", "/api/lead/shifts/"+shiftId, util.StrPtr(`{"headCount": 3}`), &leadToken)
+	assert.Equal(t, 200, code)
+
+	helperIdStr := strconv.FormatUint(uint64(helper.ID), 10)
+	code, body = sendReq(router, "POST", "/api/lead/shifts/"+shiftId+"/user/"+helperIdStr, nil, &leadToken)
+	checkRes(t, 200, code, umGeneric(body))
+	code, body = sendReq(router, "DELETE", "/api/lead/shifts/"+shiftId+"/user/"+helperIdStr, nil, &leadToken)
+	checkRes(t, 200, code, umGeneric(body))
+
+	// leads cannot force overlapping shifts
+	barIdUint, _ := strconv.ParseUint(barId, 10, 32)
+	barTeamId := uint(barIdUint)
+	start := time.Date(2025, 6, 7, 20, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	early := models.Shift{Name: "Theke 1", HeadCount: 1, StartTime: &start, EndTime: &end, TeamID: &barTeamId}
+	late := models.Shift{Name: "Theke 2", HeadCount: 1, StartTime: &start, EndTime: &end, TeamID: &barTeamId}
+	tx.Create(&early)
+	tx.Create(&late)
+	tx.Create(&models.ShiftUser{ShiftID: early.ID, UserID: helper.ID})
+	code, _ = sendReq(router, "POST", "/api/lead/shifts/"+strconv.FormatUint(uint64(late.ID), 10)+"/user/"+helperIdStr+"?force=true", nil, &leadToken)
+	assert.Equal(t, 400, code)
+
+	// editing a shift must keep its roster intact
+	earlyId := strconv.FormatUint(uint64(early.ID), 10)
+	code, _ = sendReq(router, "PUT", "/api/lead/shifts/"+earlyId, util.StrPtr(`{"headCount": 0}`), &leadToken)
+	assert.Equal(t, 409, code)
+	nightStart := start.Add(4 * time.Hour)
+	nightEnd := nightStart.Add(2 * time.Hour)
+	night := models.Shift{Name: "Theke 3", HeadCount: 1, StartTime: &nightStart, EndTime: &nightEnd, TeamID: &barTeamId}
+	tx.Create(&night)
+	tx.Create(&models.ShiftUser{ShiftID: night.ID, UserID: helper.ID})
+	nightId := strconv.FormatUint(uint64(night.ID), 10)
+	b = fmt.Sprintf(`{"startTime": "%s", "endTime": "%s"}`, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	code, _ = sendReq(router, "PUT", "/api/lead/shifts/"+nightId+"?force=true", &b, &leadToken)
+	assert.Equal(t, 409, code)
+	code, _ = sendReq(router, "PUT", "/api/admin/shifts/"+nightId, &b, &token)
+	assert.Equal(t, 409, code)
+	code, _ = sendReq(router, "PUT", "/api/admin/shifts/"+nightId+"?force=true", &b, &token)
+	assert.Equal(t, 200, code)
+
+	// no admin rights for leads or helpers
+	code, _ = sendReq(router, "GET", "/api/admin/users/", nil, &leadToken)
+	assert.Equal(t, 403, code)
+	code, _ = sendReq(router, "GET", "/api/lead/shifts/", nil, &helperToken)
+	assert.Equal(t, 403, code)
+
+	// admins can use the lead routes for every team
+	b = fmt.Sprintf(`{"name": "Kochen", "headCount": 2, "teamId": %s}`, kitchenId)
+	code, body = sendReq(router, "POST", "/api/lead/shifts/", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	kitchenShiftId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	// candidates only for shifts of the own teams
+	code, _ = sendReq(router, "GET", "/api/lead/shifts/"+shiftId+"/candidates", nil, &leadToken)
+	assert.Equal(t, 200, code)
+	code, _ = sendReq(router, "GET", "/api/lead/shifts/"+kitchenShiftId+"/candidates", nil, &leadToken)
+	assert.Equal(t, 403, code)
+	code, _ = sendReq(router, "GET", "/api/lead/shifts/999999/candidates", nil, &leadToken)
+	assert.Equal(t, 404, code)
+}
+
+func TestAutoAssign(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+
+	spot := models.SpotType{Name: "Haus", Price: 200, Limit: 10, RequiredPoints: 2}
+	tx.Create(&spot)
+	early, _ := createActiveUser(tx, "early@blub.io", "early")
+	late, _ := createActiveUser(tx, "late@blub.io", "late")
+	tx.Model(&early).Update("spot_type_id", spot.ID)
+	tx.Model(&late).Update("spot_type_id", spot.ID)
+
+	day := time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC)
+	shiftAt := func(name string, hour int, points uint8) models.Shift {
+		start := day.Add(time.Duration(hour) * time.Hour)
+		end := start.Add(2 * time.Hour)
+		shift := models.Shift{Name: name, HeadCount: 1, Points: points, StartTime: &start, EndTime: &end}
+		tx.Create(&shift)
+		return shift
+	}
+	morning := shiftAt("Frühstück", 8, 2)
+	evening := shiftAt("Bar", 18, 2)
+
+	// early is only there in the morning
+	tx.Create(&models.Availability{UserID: early.ID, StartTime: day.Add(6 * time.Hour), EndTime: day.Add(12 * time.Hour)})
+
+	code, body := sendReq(router, "POST", "/api/admin/shifts/autoassign/preview", nil, &token)
+	assert.Equal(t, 200, code)
+	var proposal AutoAssignProposal
+	if err := json.Unmarshal(body, &proposal); err != nil {
+		t.Errorf("Bad Proposal Response")
+	}
+	assert.Equal(t, 2, len(proposal.Assignments))
+	assert.Equal(t, 0, proposal.UnfilledSeats)
+	assert.Equal(t, 0, proposal.UsersBelowQuota)
+	for _, a := range proposal.Assignments {
+		if a.ShiftID == evening.ID {
+			assert.Equal(t, late.ID, a.UserID)
+		}
+		if a.ShiftID == morning.ID {
+			assert.Equal(t, early.ID, a.UserID)
+		}
+	}
+
+	// preview does not change anything
+	shift, _ := GetShiftById(tx, strconv.FormatUint(uint64(morning.ID), 10))
+	assert.Equal(t, 0, len(shift.Users))
+
+	applyBody, _ := json.Marshal(AutoAssignApply{Assignments: proposal.Assignments})
+	b := string(applyBody)
+	code, body = sendReq(router, "POST", "/api/admin/shifts/autoassign/apply", &b, &token)
+	checkRes(t, 200, code, umGeneric(body))
+	shift, _ = GetShiftById(tx, strconv.FormatUint(uint64(morning.ID), 10))
+	assert.Equal(t, 1, len(shift.Users))
+
+	// applying again fails as a whole
+	code, _ = sendReq(router, "POST", "/api/admin/shifts/autoassign/apply", &b, &token)
+	assert.Equal(t, 409, code)
+
+	// someone who can't help with the clean-up on Monday is still there on Sunday
+	leaver, _ := createActiveUser(tx, "leaver@blub.io", "leaver")
+	tx.Model(&leaver).Updates(map[string]interface{}{"spot_type_id": spot.ID, "sunday_shift": "kann nicht"})
+	day = time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC)
+	sunday := shiftAt("Abbau", 10, 2)
+	b = fmt.Sprintf(`{"shiftIds": [%d]}`, sunday.ID)
+	code, body = sendReq(router, "POST", "/api/admin/shifts/autoassign/preview", &b, &token)
+	assert.Equal(t, 200, code)
+	if err := json.Unmarshal(body, &proposal); err != nil {
+		t.Errorf("Bad Proposal Response")
+	}
+	assert.Equal(t, 1, len(proposal.Assignments))
+	assert.Equal(t, leaver.ID, proposal.Assignments[0].UserID)
+
+	// but has left before the clean-up starts at 11:00
+	day = time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC)
+	cleanup := shiftAt("Aufräumen", 10, 2)
+	b = fmt.Sprintf(`{"shiftIds": [%d]}`, cleanup.ID)
+	code, body = sendReq(router, "POST", "/api/admin/shifts/autoassign/preview", &b, &token)
+	assert.Equal(t, 200, code)
+	if err := json.Unmarshal(body, &proposal); err != nil {
+		t.Errorf("Bad Proposal Response")
+	}
+	assert.Equal(t, 0, len(proposal.Assignments))
+	assert.Equal(t, 1, proposal.UnfilledSeats)
+
+	tx.Model(&leaver).Update("sunday_shift", "früh")
+	code, body = sendReq(router, "POST", "/api/admin/shifts/autoassign/preview", &b, &token)
+	assert.Equal(t, 200, code)
+	if err := json.Unmarshal(body, &proposal); err != nil {
+		t.Errorf("Bad Proposal Response")
+	}
+	assert.Equal(t, 1, len(proposal.Assignments))
+	assert.Equal(t, leaver.ID, proposal.Assignments[0].UserID)
+}
+
+func TestShiftAvailability(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	user, userToken := createActiveUser(tx, "available@blub.io", "available")
+	team := models.Team{Name: "Küche"}
+	tx.Create(&team)
+
+	day := time.Date(2025, 6, 7, 0, 0, 0, 0, time.UTC)
+	start := day.Add(20 * time.Hour)
+	end := start.Add(2 * time.Hour)
+	shift := models.Shift{Name: "Abwasch", HeadCount: 2, Points: 1, StartTime: &start, EndTime: &end, TeamID: &team.ID}
+	tx.Create(&shift)
+	shiftId := strconv.FormatUint(uint64(shift.ID), 10)
+
+	// end before start
+	b := `{"availability": [{"startTime": "2025-06-07T12:00:00Z", "endTime": "2025-06-07T08:00:00Z"}]}`
+	code, _ := sendReq(router, "PUT", "/api/user/me/availability", &b, &userToken)
+	assert.Equal(t, 400, code)
+
+	b = fmt.Sprintf(`{"availability": [{"startTime": "2025-06-07T08:00:00Z", "endTime": "2025-06-07T14:00:00Z"}],
+		"preferences": [{"teamId": %d, "likes": true}]}`, team.ID)
+	code, body := sendReq(router, "PUT", "/api/user/me/availability", &b, &userToken)
+	checkRes(t, 200, code, umGeneric(body))
+	code, body = sendReq(router, "GET", "/api/user/me/availability", nil, &userToken)
+	assert.Equal(t, 200, code)
+	var saved AvailabilityInOut
+	if err := json.Unmarshal(body, &saved); err != nil {
+		t.Errorf("Bad Availability Response")
+	}
+	assert.Equal(t, 1, len(saved.Availability))
+	assert.Equal(t, 1, len(saved.Preferences))
+
+	// the evening shift is outside of the availability
+	code, body = sendReq(router, "GET", "/api/admin/shifts/"+shiftId+"/candidates", nil, &token)
+	assert.Equal(t, 200, code)
+	var candidates []ShiftCandidate
+	if err := json.Unmarshal(body, &candidates); err != nil {
+		t.Errorf("Bad Candidates Response")
+	}
+	for _, candidate := range candidates {
+		assert.NotEqual(t, user.ID, candidate.User.ID)
+	}
+
+	userIdStr := strconv.FormatUint(uint64(user.ID), 10)
+	code, body = sendReq(router, "POST", "/api/admin/shifts/"+shiftId+"/user/"+userIdStr, nil, &token)
+	assert.Equal(t, 200, code)
+	var out ShiftOut
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Errorf("Bad Shift Response")
+	}
+	assert.Equal(t, 1, len(out.Warnings))
+	code, _ = sendReq(router, "DELETE", "/api/admin/shifts/"+shiftId+"/user/"+userIdStr, nil, &token)
+	assert.Equal(t, 200, code)
+
+	// available the whole day, now the user is a candidate that likes the shift
+	b = `{"availability": [{"startTime": "2025-06-07T08:00:00Z", "endTime": "2025-06-08T02:00:00Z"}]}`
+	code, _ = sendReq(router, "PUT", "/api/user/me/availability", &b, &userToken)
+	assert.Equal(t, 200, code)
+	code, body = sendReq(router, "GET", "/api/admin/shifts/"+shiftId+"/candidates", nil, &token)
+	assert.Equal(t, 200, code)
+	candidates = nil
+	if err := json.Unmarshal(body, &candidates); err != nil {
+		t.Errorf("Bad Candidates Response")
+	}
+	found := false
+	for _, candidate := range candidates {
+		if candidate.User.ID == user.ID {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestShiftDeadlines(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	user, userToken := createActiveUser(tx, "late@blub.io", "late")
+	friend, friendToken := createActiveUser(tx, "punctual@blub.io", "punctual")
+
+	b := `{"name": "Abbau", "headCount": 2, "removalDeadline": "2020-01-01T12:00:00Z"}`
+	code, body := sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	shiftId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &userToken)
+	assert.Equal(t, 200, code)
+
+	// the deadline has passed
+	code, _ = sendReq(router, "DELETE", "/api/user/shifts/"+shiftId+"/me", nil, &userToken)
+	assert.Equal(t, 403, code)
+
+	// a swap still works
+	b = fmt.Sprintf(`{"toUserId": %d}`, friend.ID)
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/swap", &b, &userToken)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	swapId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+	code, body = sendReq(router, "POST", "/api/user/swaps/"+swapId+"/accept", nil, &friendToken)
+	checkRes(t, 200, code, umGeneric(body))
+
+	// once the roster is final nobody can sign up on their own, admins still can
+	code, _ = sendReq(router, "PUT", "/api/admin/shifts/"+shiftId, util.StrPtr(`{"signupClosed": true}`), &token)
+	assert.Equal(t, 200, code)
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &userToken)
+	assert.Equal(t, 403, code)
+	userIdStr := strconv.FormatUint(uint64(user.ID), 10)
+	code, _ = sendReq(router, "POST", "/api/admin/shifts/"+shiftId+"/user/"+userIdStr, nil, &token)
+	assert.Equal(t, 200, code)
+	code, _ = sendReq(router, "DELETE", "/api/admin/shifts/"+shiftId+"/user/"+userIdStr, nil, &token)
+	assert.Equal(t, 200, code)
+}
+
+func TestShiftImportExport(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+
+	sheet := `key,day,starttime,endtime,name,headcount,points
+bar-1,Freitag,20:00,02:00,Bar,2,2
+bar-2,Samstag,20:00,02:00,Bar,2,2
+kaputt,Dienstag,20:00,,Bar,2,1
+`
+	// dry run reports every row and saves nothing
+	code, body := uploadCSV(router, "/api/admin/shifts/import?dryRun=true", sheet, &token)
+	assert.Equal(t, 200, code)
+	var result ShiftImportResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Errorf("Bad Import Response")
+	}
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, 3, len(result.Rows))
+	assert.Equal(t, ImportError, result.Rows[2].Action)
+	var count int64
+	tx.Model(&models.Shift{}).Where("external_key IS NOT NULL").Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// strict mode rejects the whole file
+	code, _ = uploadCSV(router, "/api/admin/shifts/import?strict=true", sheet, &token)
+	assert.Equal(t, 400, code)
+	tx.Model(&models.Shift{}).Where("external_key IS NOT NULL").Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	code, _ = uploadCSV(router, "/api/admin/shifts/import", sheet, &token)
+	assert.Equal(t, 200, code)
+	tx.Model(&models.Shift{}).Where("external_key IS NOT NULL").Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// importing the edited sheet again updates the shifts
+	sheet = `key,day,starttime,endtime,name,headcount,points
+bar-1,Freitag,21:00,02:00,Bar (früh),3,2
+`
+	code, body = uploadCSV(router, "/api/admin/shifts/import", sheet, &token)
+	assert.Equal(t, 200, code)
+	result = ShiftImportResult{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Errorf("Bad Import Response")
+	}
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, 0, result.Created)
+	tx.Model(&models.Shift{}).Where("external_key IS NOT NULL").Count(&count)
+	assert.Equal(t, int64(2), count)
+	var shift models.Shift
+	tx.First(&shift, "external_key = ?", "bar-1")
+	assert.Equal(t, "Bar (früh)", shift.Name)
+	assert.Equal(t, uint8(3), shift.HeadCount)
+	// the time is on the date of the event day, the end after midnight
+	assert.True(t, shift.StartTime.Equal(time.Date(2025, 6, 6, 21, 0, 0, 0, models.EventLocation())))
+	assert.True(t, shift.EndTime.Equal(time.Date(2025, 6, 7, 2, 0, 0, 0, models.EventLocation())))
+
+	code, body = sendReq(router, "GET", "/api/admin/shifts/export", nil, &token)
+	assert.Equal(t, 200, code)
+	assert.True(t, strings.HasPrefix(string(body), "key,day,starttime,endtime,name,description,headcount,points"))
+	assert.Contains(t, string(body), "bar-1,Freitag,21:00,02:00,Bar (früh),,3,2")
+
+	code, body = sendReq(router, "GET", "/api/admin/shifts/export?format=xlsx", nil, &token)
+	assert.Equal(t, 200, code)
+	assert.True(t, bytes.HasPrefix(body, []byte("PK")))
+
+	// shifts from the API have no day, the export takes it from the start time so they can be imported again
+	b := `{"name": "Küche", "headCount": 2, "startTime": "2025-06-07T08:00:00Z", "endTime": "2025-06-07T10:00:00Z"}`
+	code, body = sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	kitchenId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+	code, body = sendReq(router, "GET", "/api/admin/shifts/export", nil, &token)
+	assert.Equal(t, 200, code)
+	assert.Contains(t, string(body), "#"+kitchenId+",Samstag,10:00,12:00,Küche,,2,0")
+
+	code, body = uploadCSV(router, "/api/admin/shifts/import", string(body), &token)
+	assert.Equal(t, 200, code)
+	result = ShiftImportResult{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Errorf("Bad Import Response")
+	}
+	assert.Equal(t, 0, result.Failed)
+	var kitchen models.Shift
+	tx.First(&kitchen, kitchenId)
+	assert.True(t, kitchen.StartTime.Equal(time.Date(2025, 6, 7, 8, 0, 0, 0, time.UTC)))
+	assert.True(t, kitchen.EndTime.Equal(time.Date(2025, 6, 7, 10, 0, 0, 0, time.UTC)))
+}
+
+func TestEventDays(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+
+	code, body := sendReq(router, "GET", "/api/user/eventdays", nil, &token)
+	assert.Equal(t, 200, code)
+	var days []models.EventDay
+	if err := json.Unmarshal(body, &days); err != nil {
+		t.Errorf("Bad Event Days Response")
+	}
+	assert.Equal(t, len(models.EventDays()), len(days))
+
+	// days can be given by date and are stored by name
+	b := `{"name": "Aufbau", "headCount": 1, "day": "2025-06-07"}`
+	code, body = sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	assert.Equal(t, "Samstag", bodyMap["day"])
+
+	b = `{"name": "Aufbau", "headCount": 1, "day": "Dienstag"}`
+	code, _ = sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	assert.Equal(t, 400, code)
+}
+
+func TestShiftAttendance(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	user, userToken := createActiveUser(tx, "attendee@blub.io", "attendee")
+	userIdStr := strconv.FormatUint(uint64(user.ID), 10)
+
+	shiftAt := func(name string, start time.Time) string {
+		shift := models.Shift{Name: name, HeadCount: 2, Points: 2, StartTime: &start}
+		tx.Create(&shift)
+		shiftId := strconv.FormatUint(uint64(shift.ID), 10)
+		code, _ := sendReq(router, "POST", "/api/admin/shifts/"+shiftId+"/user/"+userIdStr, nil, &token)
+		assert.Equal(t, 200, code)
+		return shiftId
+	}
+	done := shiftAt("Aufbau", time.Now().Add(-48*time.Hour))
+	missed := shiftAt("Abbau", time.Now().Add(-24*time.Hour))
+	future := shiftAt("Bar", time.Now().Add(24*time.Hour))
+
+	// signed up for 6 points, nothing earned yet
+	code, body := sendReq(router, "GET", "/api/user/me", nil, &userToken)
+	bodyMap := umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, float64(6), bodyMap["shiftPoints"])
+	assert.Equal(t, float64(0), bodyMap["earnedPoints"])
+
+	code, _ = sendReq(router, "PUT", "/api/admin/shifts/"+done+"/user/"+userIdStr+"/attendance", util.StrPtr(`{"attendance": "completed"}`), &token)
+	assert.Equal(t, 200, code)
+	code, _ = sendReq(router, "PUT", "/api/admin/shifts/"+missed+"/user/"+userIdStr+"/attendance", util.StrPtr(`{"attendance": "no_show"}`), &token)
+	assert.Equal(t, 200, code)
+	// the future shift can't be completed yet, only excused
+	code, _ = sendReq(router, "PUT", "/api/admin/shifts/"+future+"/user/"+userIdStr+"/attendance", util.StrPtr(`{"attendance": "completed"}`), &token)
+	assert.Equal(t, 400, code)
+	code, _ = sendReq(router, "PUT", "/api/admin/shifts/"+future+"/user/"+userIdStr+"/attendance", util.StrPtr(`{"attendance": "vacation"}`), &token)
+	assert.Equal(t, 400, code)
+
+	code, body = sendReq(router, "GET", "/api/user/me", nil, &userToken)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, float64(4), bodyMap["shiftPoints"])
+	assert.Equal(t, float64(2), bodyMap["earnedPoints"])
+	assert.Equal(t, float64(1), bodyMap["noShows"])
+
+	code, body = sendReq(router, "GET", "/api/admin/shifts/"+missed+"/attendance", nil, &token)
+	assert.Equal(t, 200, code)
+	var attendance []AttendanceOut
+	if err := json.Unmarshal(body, &attendance); err != nil {
+		t.Errorf("Bad Attendance Response")
+	}
+	assert.Equal(t, 1, len(attendance))
+	assert.Equal(t, models.AttendanceNoShow, *attendance[0].Attendance)
+
+	code, body = sendReq(router, "GET", "/api/admin/shifts/noshows", nil, &token)
+	assert.Equal(t, 200, code)
+	var report []NoShowOut
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Errorf("Bad No-Show Response")
+	}
+	assert.Equal(t, 1, len(report))
+	assert.Equal(t, user.ID, report[0].User.ID)
+	assert.Equal(t, 1, report[0].NoShows)
+}
+
+func TestShiftStandby(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	_, firstToken := createActiveUser(tx, "first@blub.io", "first")
+	_, secondToken := createActiveUser(tx, "second@blub.io", "second")
+	third, thirdToken := createActiveUser(tx, "third@blub.io", "third")
+
+	b := `{"name": "Einlass", "headCount": 1}`
+	code, body := sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	shiftId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	// no standby while there are free seats
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/standby", nil, &secondToken)
+	assert.Equal(t, 400, code)
+
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &firstToken)
+	assert.Equal(t, 200, code)
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &secondToken)
+	assert.Equal(t, 409, code)
+
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/standby", nil, &thirdToken)
+	assert.Equal(t, 200, code)
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/standby", nil, &secondToken)
+	assert.Equal(t, 200, code)
+	var out ShiftOut
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Errorf("Bad Shift Response")
+	}
+	assert.Equal(t, 2, out.StandbyCount)
+	assert.Equal(t, 2, *out.StandbyPosition)
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/standby", nil, &secondToken)
+	assert.Equal(t, 400, code)
+
+	// the queue position shows up in the shift list
+	code, body = sendReq(router, "GET", "/api/user/shifts", nil, &thirdToken)
+	assert.Equal(t, 200, code)
+	var shifts []ShiftOut
+	if err := json.Unmarshal(body, &shifts); err != nil {
+		t.Errorf("Bad Shifts Response")
+	}
+	for _, shift := range shifts {
+		if strconv.FormatUint(uint64(shift.ID), 10) == shiftId {
+			assert.Equal(t, 1, *shift.StandbyPosition)
+		}
+	}
+
+	// when first leaves, third moves up and second is next in line
+	code, body = sendReq(router, "DELETE", "/api/user/shifts/"+shiftId+"/me", nil, &firstToken)
+	checkRes(t, 200, code, umGeneric(body))
+	shift, _ := GetShiftById(tx, shiftId)
+	assert.Equal(t, 1, len(shift.Users))
+	assert.Equal(t, third.ID, shift.Users[0].ID)
+	var standbys []models.ShiftStandby
+	tx.Where("shift_id = ?", shift.ID).Find(&standbys)
+	assert.Equal(t, 1, len(standbys))
+
+	code, _ = sendReq(router, "DELETE", "/api/user/shifts/"+shiftId+"/standby", nil, &secondToken)
+	assert.Equal(t, 200, code)
+	code, _ = sendReq(router, "DELETE", "/api/user/shifts/"+shiftId+"/standby", nil, &secondToken)
+	assert.Equal(t, 400, code)
+	// leaving the standby list does not touch the roster
+	shift, _ = GetShiftById(tx, shiftId)
+	assert.Equal(t, 1, len(shift.Users))
+	assert.Equal(t, third.ID, shift.Users[0].ID)
+	tx.Where("shift_id = ?", shift.ID).Find(&standbys)
+	assert.Equal(t, 0, len(standbys))
+}
+
+func TestShiftTemplates(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	user, _ := createActiveUser(tx, "regular@blub.io", "regular")
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Hour).UTC()
+	b := fmt.Sprintf(`{"name": "Bar", "headCount": 2, "points": 2, "durationMinutes": 180,
+		"start": "%s", "rrule": "FREQ=HOURLY;INTERVAL=3;COUNT=4"}`, start.Format(time.RFC3339))
+	code, body := sendReq(router, "POST", "/api/admin/shifttemplates/", &b, &token)
+	assert.Equal(t, 201, code)
+	var out ShiftTemplateOut
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Errorf("Bad Template Response")
+	}
+	assert.Equal(t, 4, out.Sync.Created)
+	templateId := strconv.FormatUint(uint64(out.ID), 10)
+
+	var shifts []models.Shift
+	tx.Where("template_id = ?", out.ID).Order("start_time").Find(&shifts)
+	assert.Equal(t, 4, len(shifts))
+	assert.True(t, shifts[1].StartTime.Equal(start.Add(3*time.Hour)))
+	assert.True(t, shifts[1].EndTime.Equal(start.Add(6*time.Hour)))
+
+	// someone signs up for the second one, it is not touched anymore
+	signedUp := strconv.FormatUint(uint64(shifts[1].ID), 10)
+	userIdStr := strconv.FormatUint(uint64(user.ID), 10)
+	code, _ = sendReq(router, "POST", "/api/admin/shifts/"+signedUp+"/user/"+userIdStr, nil, &token)
+	assert.Equal(t, 200, code)
+
+	code, body = sendReq(router, "PUT", "/api/admin/shifttemplates/"+templateId, util.StrPtr(`{"headCount": 4}`), &token)
+	assert.Equal(t, 200, code)
+	out = ShiftTemplateOut{}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Errorf("Bad Template Response")
+	}
+	assert.Equal(t, 3, out.Sync.Updated)
+	assert.Equal(t, 1, out.Sync.Kept)
+	shift, _ := GetShiftById(tx, signedUp)
+	assert.Equal(t, uint8(2), shift.HeadCount)
+	shift, _ = GetShiftById(tx, strconv.FormatUint(uint64(shifts[0].ID), 10))
+	assert.Equal(t, uint8(4), shift.HeadCount)
+
+	// fewer repetitions remove the unfilled shifts at the end, together with their standby lists
+	tx.Create(&models.ShiftStandby{ShiftID: shifts[3].ID, UserID: user.ID})
+	code, body = sendReq(router, "PUT", "/api/admin/shifttemplates/"+templateId, util.StrPtr(`{"rrule": "FREQ=HOURLY;INTERVAL=3;COUNT=2"}`), &token)
+	assert.Equal(t, 200, code)
+	out = ShiftTemplateOut{}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Errorf("Bad Template Response")
+	}
+	assert.Equal(t, 2, out.Sync.Deleted)
+	var count int64
+	tx.Model(&models.Shift{}).Where("template_id = ?", out.ID).Count(&count)
+	assert.Equal(t, int64(2), count)
+	tx.Model(&models.ShiftStandby{}).Where("shift_id = ?", shifts[3].ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	code, _ = sendReq(router, "PUT", "/api/admin/shifttemplates/"+templateId, util.StrPtr(`{"rrule": "FREQ=WEEKLY"}`), &token)
+	assert.Equal(t, 400, code)
+
+	// deleting the template keeps the shift with people in it
+	tx.Create(&models.ShiftStandby{ShiftID: shifts[0].ID, UserID: user.ID})
+	code, _ = sendReq(router, "DELETE", "/api/admin/shifttemplates/"+templateId, nil, &token)
+	assert.Equal(t, 200, code)
+	tx.Model(&models.Shift{}).Where("id IN ?", []uint{shifts[0].ID, shifts[1].ID}).Count(&count)
+	assert.Equal(t, int64(1), count)
+	tx.Model(&models.ShiftStandby{}).Where("shift_id = ?", shifts[0].ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestRosterPrivacy(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	private, privateToken := createActiveUser(tx, "private@blub.io", "private")
+	_, viewerToken := createActiveUser(tx, "viewer@blub.io", "viewer")
+	// admin created users may have no full name at all
+	nameless := models.User{Nickname: "nameless", Type: "reg", IsActivated: true}
+	tx.Create(&nameless)
+
+	shift := models.Shift{Name: "Garderobe", HeadCount: 3, Points: 1}
+	tx.Create(&shift)
+	tx.Model(&shift).Association("Users").Append([]*models.User{&private, &nameless})
+
+	rosterOf := func(token string) []ShiftParticipant {
+		code, body := sendReq(router, "GET", "/api/user/shifts", nil, &token)
+		assert.Equal(t, 200, code)
+		var shifts []ShiftOut
+		if err := json.Unmarshal(body, &shifts); err != nil {
+			t.Errorf("Bad Shifts Response")
+		}
+		for _, s := range shifts {
+			if s.ID == shift.ID {
+				return s.Participants
+			}
+		}
+		t.Errorf("Shift not in list")
+		return nil
+	}
+	fullNameOf := func(participants []ShiftParticipant, id uint) *string {
+		for _, p := range participants {
+			if p.ID == id {
+				return p.FullName
+			}
+		}
+		return nil
+	}
+
+	participants := rosterOf(viewerToken)
+	assert.Equal(t, 2, len(participants))
+	assert.Nil(t, fullNameOf(participants, private.ID))
+	assert.Nil(t, fullNameOf(participants, nameless.ID))
+
+	// users see their own name, admins see all names
+	assert.Equal(t, "private Person", *fullNameOf(rosterOf(privateToken), private.ID))
+	assert.Equal(t, "private Person", *fullNameOf(rosterOf(token), private.ID))
+
+	code, _ := sendReq(router, "PUT", "/api/user/me", util.StrPtr(`{"showFullName": true}`), &privateToken)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "private Person", *fullNameOf(rosterOf(viewerToken), private.ID))
+}
+
+func TestRosterPDF(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	lead, leadToken := createActiveUser(tx, "lead@blub.io", "lead")
+	helper, _ := createActiveUser(tx, "helper@blub.io", "helper")
+
+	bar := models.Team{Name: "Bar"}
+	tx.Create(&bar)
+	kitchen := models.Team{Name: "Küche"}
+	tx.Create(&kitchen)
+	code, _ := sendReq(router, "POST", "/api/admin/teams/"+strconv.FormatUint(uint64(bar.ID), 10)+"/leads/"+strconv.FormatUint(uint64(lead.ID), 10), nil, &token)
+	assert.Equal(t, 200, code)
+
+	start := time.Date(2025, 6, 7, 18, 0, 0, 0, models.EventLocation())
+	end := start.Add(3 * time.Hour)
+	shift := models.Shift{Name: "Tresen", Day: util.StrPtr("Samstag"), StartTime: &start, EndTime: &end, TeamID: &bar.ID, HeadCount: 3, Points: 1}
+	tx.Create(&shift)
+	tx.Model(&shift).Association("Users").Append(&helper)
+
+	code, body := sendReq(router, "GET", "/api/admin/shifts/roster.pdf?day=Samstag", nil, &token)
+	assert.Equal(t, 200, code)
+	assert.True(t, bytes.HasPrefix(body, []byte("%PDF")))
+	code, body = sendReq(router, "GET", "/api/admin/shifts/roster.pdf", nil, &token)
+	assert.Equal(t, 200, code)
+	assert.True(t, bytes.HasPrefix(body, []byte("%PDF")))
+	code, _ = sendReq(router, "GET", "/api/admin/shifts/roster.pdf?day=Dienstag", nil, &token)
+	assert.Equal(t, 400, code)
+
+	// leads only print their own teams
+	code, body = sendReq(router, "GET", "/api/lead/shifts/roster.pdf?team="+strconv.FormatUint(uint64(bar.ID), 10), nil, &leadToken)
+	assert.Equal(t, 200, code)
+	assert.True(t, bytes.HasPrefix(body, []byte("%PDF")))
+	code, _ = sendReq(router, "GET", "/api/lead/shifts/roster.pdf?team="+strconv.FormatUint(uint64(kitchen.ID), 10), nil, &leadToken)
+	assert.Equal(t, 403, code)
+	code, _ = sendReq(router, "GET", "/api/lead/shifts/roster.pdf", nil, &leadToken)
+	assert.Equal(t, 400, code)
+}
+
+func TestConcurrentSignup(t *testing.T) {
+	// the requests need their own connections, so this runs outside of a test transaction
+	router := SetupRouter(testDB)
+
+	shift := models.Shift{Name: "Letzter Platz", HeadCount: 1, Points: 1}
+	testDB.Create(&shift)
+	shiftId := strconv.FormatUint(uint64(shift.ID), 10)
+	users := []models.User{}
+	tokens := []string{}
+	for i := 0; i < 8; i++ {
+		user, token := createActiveUser(testDB, fmt.Sprintf("rush%d@blub.io", i), fmt.Sprintf("rush%d", i))
+		users = append(users, user)
+		tokens = append(tokens, token)
+	}
+	defer func() {
+		testDB.Where("shift_id = ?", shift.ID).Delete(&models.ShiftUser{})
+		testDB.Delete(&shift)
+		testDB.Delete(&users)
+	}()
+
+	var wg sync.WaitGroup
+	codes := make([]int, len(tokens))
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i], _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &tokens[i])
+		}(i)
+	}
+	wg.Wait()
+
+	signedUp, full := 0, 0
+	for _, code := range codes {
+		switch code {
+		case 200:
+			signedUp++
+		case 409:
+			full++
+		}
+	}
+	assert.Equal(t, 1, signedUp)
+	assert.Equal(t, len(tokens)-1, full)
+	var count int64
+	testDB.Model(&models.ShiftUser{}).Where("shift_id = ?", shift.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	code, _ := sendReq(router, "POST", "/api/user/shifts/999999/me", nil, &tokens[0])
+	assert.Equal(t, 404, code)
+	adminToken := getToken(AdminEmail)
+	userIdStr := strconv.FormatUint(uint64(users[0].ID), 10)
+	code, _ = sendReq(router, "DELETE", "/api/admin/shifts/"+shiftId+"/user/"+userIdStr, nil, &adminToken)
+	if codes[0] == 200 {
+		assert.Equal(t, 200, code)
+	} else {
+		assert.Equal(t, 409, code)
+	}
+}
+
+func TestQualifications(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	medic, medicToken := createActiveUser(tx, "medic@blub.io", "medic")
+	other, otherToken := createActiveUser(tx, "other@blub.io", "other")
+
+	code, body := sendReq(router, "POST", "/api/admin/qualifications", util.StrPtr(`{"name": "Erste Hilfe"}`), &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	qualificationId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	code, body = sendReq(router, "POST", "/api/admin/shifts", util.StrPtr(`{"name": "Sanitaet", "headCount": 2, "qualificationIds": [`+qualificationId+`]}`), &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	shiftId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', -1, 64)
+
+	eligible := func(token string) bool {
+		code, body := sendReq(router, "GET", "/api/user/shifts", nil, &token)
+		assert.Equal(t, 200, code)
+		var shifts []ShiftOut
+		if err := json.Unmarshal(body, &shifts); err != nil {
+			t.Errorf("Bad Shifts Response")
+		}
+		for _, s := range shifts {
+			if strconv.FormatUint(uint64(s.ID), 10) == shiftId {
+				assert.Equal(t, 1, len(s.Qualifications))
+				return s.Eligible
+			}
+		}
+		t.Errorf("Shift not in list")
+		return false
+	}
+	assert.False(t, eligible(medicToken))
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &medicToken)
+	assert.Equal(t, 403, code)
+
+	// claimed qualifications only count once an admin verified them
+	code, _ = sendReq(router, "POST", "/api/user/me/qualifications/"+qualificationId, nil, &medicToken)
+	assert.Equal(t, 201, code)
+	code, _ = sendReq(router, "POST", "/api/user/me/qualifications/"+qualificationId, nil, &medicToken)
+	assert.Equal(t, 409, code)
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &medicToken)
+	assert.Equal(t, 403, code)
+
+	code, body = sendReq(router, "GET", "/api/admin/qualifications/claims?verified=false", nil, &token)
+	assert.Equal(t, 200, code)
+	var claims []UserQualificationOut
+	if err := json.Unmarshal(body, &claims); err != nil {
+		t.Errorf("Bad Claims Response")
+	}
+	assert.Equal(t, 1, len(claims))
+	assert.Equal(t, "medic", claims[0].Nickname)
+
+	medicIdStr := strconv.FormatUint(uint64(medic.ID), 10)
+	code, _ = sendReq(router, "PUT", "/api/admin/users/"+medicIdStr+"/qualifications/"+qualificationId, util.StrPtr(`{"verified": true}`), &token)
+	assert.Equal(t, 200, code)
+	assert.True(t, eligible(medicToken))
+	assert.False(t, eligible(otherToken))
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+shiftId+"/me", nil, &medicToken)
+	assert.Equal(t, 200, code)
+
+	// admins may still assign anyone, but get a warning
+	otherIdStr := strconv.FormatUint(uint64(other.ID), 10)
+	code, body = sendReq(router, "POST", "/api/admin/shifts/"+shiftId+"/user/"+otherIdStr, nil, &token)
+	assert.Equal(t, 200, code)
+	var out ShiftOut
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Errorf("Bad Shift Response")
+	}
+	assert.Equal(t, 1, len(out.Warnings))
+}
+
+func TestLeaderboardAndStats(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	owl, owlToken := createActiveUser(tx, "owl@blub.io", "owl")
+	lark, larkToken := createActiveUser(tx, "lark@blub.io", "lark")
+	shy, _ := createActiveUser(tx, "shy@blub.io", "shy")
+
+	bar := models.Team{Name: "Bar"}
+	tx.Create(&bar)
+	nightStart := time.Date(2025, 6, 6, 23, 0, 0, 0, models.EventLocation())
+	nightEnd := nightStart.Add(3 * time.Hour)
+	dayStart := time.Date(2025, 6, 7, 12, 0, 0, 0, models.EventLocation())
+	dayEnd := dayStart.Add(2 * time.Hour)
+	night := models.Shift{Name: "Nachtbar", Day: util.StrPtr("Freitag"), StartTime: &nightStart, EndTime: &nightEnd, TeamID: &bar.ID, HeadCount: 2, Points: 3}
+	tx.Create(&night)
+	noon := models.Shift{Name: "Mittag", Day: util.StrPtr("Samstag"), StartTime: &dayStart, EndTime: &dayEnd, HeadCount: 1, Points: 1}
+	tx.Create(&noon)
+	completed := models.AttendanceCompleted
+	tx.Create(&models.ShiftUser{ShiftID: night.ID, UserID: owl.ID, Attendance: &completed})
+	tx.Create(&models.ShiftUser{ShiftID: noon.ID, UserID: lark.ID, Attendance: &completed})
+	tx.Create(&models.ShiftUser{ShiftID: night.ID, UserID: shy.ID, Attendance: &completed})
+
+	for _, token := range []string{owlToken, larkToken} {
+		code, _ := sendReq(router, "PUT", "/api/user/me", util.StrPtr(`{"onLeaderboard": true}`), &token)
+		assert.Equal(t, 200, code)
+	}
+
+	code, body := sendReq(router, "GET", "/api/user/leaderboard", nil, &larkToken)
+	assert.Equal(t, 200, code)
+	var entries []LeaderboardEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		t.Errorf("Bad Leaderboard Response")
+	}
+	// shy did not opt in
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "owl", entries[0].Nickname)
+	assert.Equal(t, uint16(3), entries[0].EarnedPoints)
+	assert.Equal(t, 1, entries[0].NightShifts)
+	assert.Equal(t, "lark", entries[1].Nickname)
+	assert.Equal(t, 2, entries[1].Rank)
+
+	code, body = sendReq(router, "GET", "/api/admin/shifts/stats", nil, &token)
+	assert.Equal(t, 200, code)
+	var stats CrewStats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		t.Errorf("Bad Stats Response")
+	}
+	assert.Equal(t, 2, len(stats.Teams))
+	assert.Equal(t, "Bar", stats.Teams[0].Name)
+	assert.Equal(t, 6.0, stats.Teams[0].HoursNeeded)
+	assert.Equal(t, 6.0, stats.Teams[0].HoursCovered)
+	assert.Equal(t, 2, len(stats.Days))
+	assert.Equal(t, "Freitag", stats.Days[0].Day)
+	assert.Equal(t, 1.0, stats.Days[0].FilledFraction)
+	assert.Equal(t, "Samstag", stats.Days[1].Day)
+
+	code, _ = sendReq(router, "GET", "/api/admin/shifts/stats", nil, &larkToken)
+	assert.Equal(t, 403, code)
+}
+
+func TestRosterMoves(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	first, _ := createActiveUser(tx, "first@blub.io", "first")
+	second, _ := createActiveUser(tx, "second@blub.io", "second")
+	third, _ := createActiveUser(tx, "third@blub.io", "third")
+
+	shifts := []models.Shift{}
+	for _, name := range []string{"Einlass", "Garderobe", "Kasse"} {
+		shift := models.Shift{Name: name, HeadCount: 1, Points: 1}
+		tx.Create(&shift)
+		shifts = append(shifts, shift)
+	}
+	id := func(i int) string { return strconv.FormatUint(uint64(shifts[i].ID), 10) }
+	usersOf := func(i int) []uint {
+		var userIDs []uint
+		tx.Model(&models.ShiftUser{}).Where("shift_id = ?", shifts[i].ID).Order("user_id").Pluck("user_id", &userIDs)
+		return userIDs
+	}
+	tx.Create(&models.ShiftUser{ShiftID: shifts[0].ID, UserID: first.ID})
+	tx.Create(&models.ShiftUser{ShiftID: shifts[1].ID, UserID: second.ID})
+	firstIdStr := strconv.FormatUint(uint64(first.ID), 10)
+
+	// the target is full, so nothing changes
+	code, _ := sendReq(router, "POST", "/api/admin/shifts/"+id(0)+"/user/"+firstIdStr+"/move", util.StrPtr(`{"toShiftId": `+id(1)+`}`), &token)
+	assert.Equal(t, 409, code)
+	assert.Equal(t, []uint{first.ID}, usersOf(0))
+
+	code, body := sendReq(router, "POST", "/api/admin/shifts/"+id(0)+"/user/"+firstIdStr+"/move", util.StrPtr(`{"toShiftId": `+id(2)+`}`), &token)
+	assert.Equal(t, 200, code)
+	var out RosterUpdateOut
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Errorf("Bad Move Response")
+	}
+	assert.Equal(t, 2, len(out.Shifts))
+	assert.Empty(t, usersOf(0))
+	assert.Equal(t, []uint{first.ID}, usersOf(2))
+
+	// swap the two of them in one go
+	b := fmt.Sprintf(`{"changes": [
+		{"action": "remove", "userId": %d, "shiftId": %d},
+		{"action": "move", "userId": %d, "shiftId": %d, "toShiftId": %d},
+		{"action": "add", "userId": %d, "shiftId": %d}]}`,
+		second.ID, shifts[1].ID, first.ID, shifts[2].ID, shifts[1].ID, second.ID, shifts[2].ID)
+	code, body = sendReq(router, "POST", "/api/admin/roster", &b, &token)
+	checkRes(t, 200, code, umGeneric(body))
+	assert.Equal(t, []uint{first.ID}, usersOf(1))
+	assert.Equal(t, []uint{second.ID}, usersOf(2))
+
+	// the second add fails, so the first one is not saved either
+	b = fmt.Sprintf(`{"changes": [
+		{"action": "add", "userId": %d, "shiftId": %d},
+		{"action": "add", "userId": %d, "shiftId": %d}]}`,
+		third.ID, shifts[0].ID, second.ID, shifts[0].ID)
+	code, body = sendReq(router, "POST", "/api/admin/roster", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 409, code, bodyMap)
+	assert.Equal(t, float64(1), bodyMap["index"])
+	assert.Empty(t, usersOf(0))
+}
+
+func TestSignupLimits(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	models.SetSignupLimits(models.SignupLimitConfig{MaxShiftsPerDay: 2, MaxPointsPerDay: 10, MaxConsecutive: 8 * time.Hour, MinRest: time.Hour})
+	defer models.SetSignupLimits(models.SignupLimitConfig{})
+
+	token := getToken(AdminEmail)
+	eager, eagerToken := createActiveUser(tx, "eager@blub.io", "eager")
+	createShift := func(day string, date int, startHour int, hours float64) string {
+		start := time.Date(2025, 6, date, startHour, 0, 0, 0, models.EventLocation())
+		end := start.Add(time.Duration(hours * float64(time.Hour)))
+		shift := models.Shift{Name: "Bar", Day: &day, StartTime: &start, EndTime: &end, HeadCount: 2, Points: 2}
+		tx.Create(&shift)
+		return strconv.FormatUint(uint64(shift.ID), 10)
+	}
+	morning := createShift("Samstag", 7, 10, 2)
+	noon := createShift("Samstag", 7, 12, 2)
+	afternoon := createShift("Samstag", 7, 16, 2)
+	long := createShift("Sonntag", 8, 8, 10)
+
+	code, _ := sendReq(router, "GET", "/api/user/signuplimits", nil, &eagerToken)
+	assert.Equal(t, 200, code)
+
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+morning+"/me", nil, &eagerToken)
+	assert.Equal(t, 200, code)
+	// directly after the first one, so no rest is needed
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+noon+"/me", nil, &eagerToken)
+	assert.Equal(t, 200, code)
+	code, body := sendReq(router, "POST", "/api/user/shifts/"+afternoon+"/me", nil, &eagerToken)
+	bodyMap := umGeneric(body)
+	checkRes(t, 403, code, bodyMap)
+	assert.Contains(t, bodyMap["error"], "2 shifts per day")
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+long+"/me", nil, &eagerToken)
+	bodyMap = umGeneric(body)
+	checkRes(t, 403, code, bodyMap)
+	assert.Contains(t, bodyMap["error"], "8h in a row")
+
+	// admins can go over the limits, but are told about it
+	eagerIdStr := strconv.FormatUint(uint64(eager.ID), 10)
+	code, body = sendReq(router, "POST", "/api/admin/shifts/"+long+"/user/"+eagerIdStr, nil, &token)
+	assert.Equal(t, 200, code)
+	var out ShiftOut
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Errorf("Bad Shift Response")
+	}
+	assert.Equal(t, 1, len(out.Warnings))
+}
+
+func TestShiftFilters(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	code, body := sendReq(router, "POST", "/api/admin/shiftcategories/", util.StrPtr(`{"name": "Awareness", "color": "#ff00aa"}`), &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	categoryId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', 0, 64)
+	code, _ = sendReq(router, "POST", "/api/admin/shiftcategories/", util.StrPtr(`{"name": "Bunt", "color": "pink"}`), &token)
+	assert.Equal(t, 400, code)
+	code, body = sendReq(router, "POST", "/api/admin/shiftlocations/", util.StrPtr(`{"name": "Tor", "sitePlanArea": "C4"}`), &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	locationId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', 0, 64)
+
+	createShift := func(name string, day string, headCount int) string {
+		b := fmt.Sprintf(`{"name": "%s", "headCount": %d, "day": "%s", "categoryId": %s, "locationId": %s, "contactName": "Kim", "contactPhone": "0123"}`,
+			name, headCount, day, categoryId, locationId)
+		code, body := sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+		bodyMap := umGeneric(body)
+		checkRes(t, 201, code, bodyMap)
+		return strconv.FormatFloat(bodyMap["id"].(float64), 'f', 0, 64)
+	}
+	gate := createShift("Einlass", "Samstag", 1)
+	createShift("Auslass", "Sonntag", 2)
+	code, _ = sendReq(router, "POST", "/api/admin/shifts/", util.StrPtr(`{"name": "Nix", "headCount": 1, "categoryId": 99999}`), &token)
+	assert.Equal(t, 400, code)
+
+	_, userToken := createActiveUser(tx, "filter@blub.io", "filter")
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+gate+"/me", nil, &userToken)
+	assert.Equal(t, 200, code)
+
+	getShifts := func(query string) []ShiftOut {
+		code, body := sendReq(router, "GET", "/api/user/shifts?category="+categoryId+query, nil, &userToken)
+		assert.Equal(t, 200, code)
+		var shifts []ShiftOut
+		if err := json.Unmarshal(body, &shifts); err != nil {
+			t.Errorf("Bad Shift Response")
+		}
+		return shifts
+	}
+	shifts := getShifts("&location=" + locationId + "&sort=name")
+	assert.Equal(t, 2, len(shifts))
+	assert.Equal(t, "Auslass", shifts[0].Name)
+	assert.Equal(t, "Kim", *shifts[0].ContactName)
+	shifts = getShifts("&day=Samstag")
+	assert.Equal(t, 1, len(shifts))
+	assert.Equal(t, "Einlass", shifts[0].Name)
+	shifts = getShifts("&free=true")
+	assert.Equal(t, 1, len(shifts))
+	assert.Equal(t, "Auslass", shifts[0].Name)
+	shifts = getShifts("&mine=true")
+	assert.Equal(t, 1, len(shifts))
+	assert.Equal(t, "Einlass", shifts[0].Name)
+
+	code, _ = sendReq(router, "GET", "/api/user/shifts?day=Blursday", nil, &userToken)
+	assert.Equal(t, 400, code)
+	code, _ = sendReq(router, "GET", "/api/user/shifts?sort=color", nil, &userToken)
+	assert.Equal(t, 400, code)
+
+	// deleting the category keeps its shifts
+	code, _ = sendReq(router, "DELETE", "/api/admin/shiftcategories/"+categoryId, nil, &token)
+	assert.Equal(t, 200, code)
+	code, body = sendReq(router, "GET", "/api/user/shifts?location="+locationId, nil, &userToken)
+	assert.Equal(t, 200, code)
+	var remaining []ShiftOut
+	if err := json.Unmarshal(body, &remaining); err != nil {
+		t.Errorf("Bad Shift Response")
+	}
+	assert.Equal(t, 2, len(remaining))
+	assert.Nil(t, remaining[0].CategoryID)
+}
+
+func TestBuddySignup(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	asker, askerToken := createActiveUser(tx, "asker@blub.io", "asker")
+	friend, friendToken := createActiveUser(tx, "friend@blub.io", "friend")
+	_, otherToken := createActiveUser(tx, "other@blub.io", "other")
+	dishes := models.Shift{Name: "Abwasch", HeadCount: 3, Points: 1}
+	tx.Create(&dishes)
+	small := models.Shift{Name: "Kasse", HeadCount: 1, Points: 1}
+	tx.Create(&small)
+	dishesId := strconv.FormatUint(uint64(dishes.ID), 10)
+	friendJson := fmt.Sprintf(`{"toUserId": %d}`, friend.ID)
+
+	code, body := sendReq(router, "POST", "/api/user/shifts/"+strconv.FormatUint(uint64(small.ID), 10)+"/buddy", &friendJson, &askerToken)
+	bodyMap := umGeneric(body)
+	checkRes(t, 409, code, bodyMap)
+
+	code, body = sendReq(router, "POST", "/api/user/shifts/"+dishesId+"/buddy", &friendJson, &askerToken)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	buddyId := strconv.FormatFloat(bodyMap["id"].(float64), 'f', 0, 64)
+	var count int64
+	tx.Model(&models.ShiftUser{}).Where("shift_id = ?", dishes.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	code, body = sendReq(router, "GET", "/api/user/buddies", nil, &friendToken)
+	assert.Equal(t, 200, code)
+	var buddies []BuddyOut
+	if err := json.Unmarshal(body, &buddies); err != nil {
+		t.Errorf("Bad Buddy Response")
+	}
+	assert.Equal(t, 1, len(buddies))
+	assert.Equal(t, asker.ID, buddies[0].FromUser.ID)
+	// only their own full name, the asker did not make theirs public
+	assert.Nil(t, buddies[0].FromUser.FullName)
+	assert.Equal(t, "friend Person", *buddies[0].ToUser.FullName)
+
+	// only the friend can confirm
+	code, _ = sendReq(router, "POST", "/api/user/buddies/"+buddyId+"/confirm", nil, &askerToken)
+	assert.Equal(t, 403, code)
+
+	// someone else takes a seat, so there is no room for both anymore
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+dishesId+"/me", nil, &otherToken)
+	assert.Equal(t, 200, code)
+	code, _ = sendReq(router, "POST", "/api/user/shifts/"+dishesId+"/me", nil, &askerToken)
+	assert.Equal(t, 200, code)
+	code, body = sendReq(router, "POST", "/api/user/buddies/"+buddyId+"/confirm", nil, &friendToken)
+	checkRes(t, 409, code, umGeneric(body))
+	tx.Model(&models.ShiftUser{}).Where("shift_id = ? AND user_id = ?", dishes.ID, friend.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// once a seat is free again, both get theirs at once
+	code, _ = sendReq(router, "DELETE", "/api/user/shifts/"+dishesId+"/me", nil, &askerToken)
+	assert.Equal(t, 200, code)
+	code, body = sendReq(router, "POST", "/api/user/buddies/"+buddyId+"/confirm", nil, &friendToken)
+	bodyMap = umGeneric(body)
+	checkRes(t, 200, code, bodyMap)
+	assert.Equal(t, models.BuddyConfirmed, bodyMap["status"])
+	tx.Model(&models.ShiftUser{}).Where("shift_id = ?", dishes.ID).Count(&count)
+	assert.Equal(t, int64(3), count)
+
+	code, _ = sendReq(router, "DELETE", "/api/user/buddies/"+buddyId, nil, &friendToken)
+	assert.Equal(t, 409, code)
+}
+
+func TestMarkdownDescriptions(t *testing.T) {
+	tx := testDB.Begin()
+	defer tx.Rollback()
+	router := SetupRouter(tx)
+
+	token := getToken(AdminEmail)
+	b := `{"name": "Abwasch", "headCount": 2, "description": "**Handschuhe** mitbringen, siehe [Plan](https://example.org)\n\n<script>alert(1)</script>"}`
+	code, body := sendReq(router, "POST", "/api/admin/shifts/", &b, &token)
+	bodyMap := umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	assert.Contains(t, bodyMap["description"], "**Handschuhe**")
+	assert.Contains(t, bodyMap["descriptionHtml"], "<strong>Handschuhe</strong>")
+	assert.Contains(t, bodyMap["descriptionHtml"], `<a href="https://example.org"`)
+	assert.NotContains(t, bodyMap["descriptionHtml"], "<script>")
+
+	code, body = sendReq(router, "GET", "/api/admin/shifts", nil, &token)
+	assert.Equal(t, 200, code)
+	var shifts []ShiftOut
+	if err := json.Unmarshal(body, &shifts); err != nil {
+		t.Errorf("Bad Shift Response")
+	}
+	for _, shift := range shifts {
+		if shift.Name == "Abwasch" {
+			assert.Contains(t, *shift.DescriptionHTML, "<strong>Handschuhe</strong>")
+		}
+	}
+
+	b = `{"title": "Wichtig", "body": "- Zelt\n- <img src=x onerror=alert(1)>Schlafsack"}`
+	code, body = sendReq(router, "POST", "/api/admin/announcements/", &b, &token)
+	bodyMap = umGeneric(body)
+	checkRes(t, 201, code, bodyMap)
+	assert.Contains(t, bodyMap["bodyHtml"], "<li>Zelt</li>")
+	assert.NotContains(t, bodyMap["bodyHtml"], "onerror")
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+type SignupLimitsOut struct {
+	MaxPointsPerDay       int `json:"maxPointsPerDay"`
+	MaxShiftsPerDay       int `json:"maxShiftsPerDay"`
+	MaxConsecutiveMinutes int `json:"maxConsecutiveMinutes"`
+	MinRestMinutes        int `json:"minRestMinutes"`
+}
+
+var ErrSignupLimit = errors.New("sign-up limit reached")
+
+// formatDuration prints durations like 8h or 1h30m instead of 8h0m0s
+func formatDuration(d time.Duration) string {
+	s := strings.TrimSuffix(d.String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// checkSignupLimits returns ErrSignupLimit if taking the shift would bring the user over one of the
+// configured caps. The shift itself is left out of the users shifts, so it also works after adding.
+func checkSignupLimits(db *gorm.DB, shift models.Shift, userID uint) error {
+	limits := models.SignupLimits()
+	if limits == (models.SignupLimitConfig{}) {
+		return nil
+	}
+	var shifts []models.Shift
+	err := db.Joins("join shift_users on shifts.id = shift_users.shift_id").
+		Where("shift_users.user_id = ? AND shifts.id <> ?", userID, shift.ID).Find(&shifts).Error
+	if err != nil {
+		return err
+	}
+
+	if day := statsDay(shift); day != "" {
+		points, count := int(shift.Points), 1
+		for _, s := range shifts {
+			if statsDay(s) == day {
+				points += int(s.Points)
+				count++
+			}
+		}
+		if limits.MaxShiftsPerDay > 0 && count > limits.MaxShiftsPerDay {
+			return fmt.Errorf("%w: you can only take %d shifts per day", ErrSignupLimit, limits.MaxShiftsPerDay)
+		}
+		if limits.MaxPointsPerDay > 0 && points > limits.MaxPointsPerDay {
+			return fmt.Errorf("%w: you can only collect %d points per day", ErrSignupLimit, limits.MaxPointsPerDay)
+		}
+	}
+
+	if shift.StartTime == nil || shift.EndTime == nil {
+		return nil
+	}
+	if limits.MinRest > 0 {
+		for _, s := range shifts {
+			if s.StartTime == nil || s.EndTime == nil {
+				continue
+			}
+			var rest time.Duration
+			if !s.StartTime.Before(*shift.EndTime) {
+				rest = s.StartTime.Sub(*shift.EndTime)
+			} else if !shift.StartTime.Before(*s.EndTime) {
+				rest = shift.StartTime.Sub(*s.EndTime)
+			} else {
+				// overlapping shifts are caught by the overlap check
+				continue
+			}
+			if rest > 0 && rest < limits.MinRest {
+				return fmt.Errorf("%w: you need at least %s of rest between two shifts", ErrSignupLimit, formatDuration(limits.MinRest))
+			}
+		}
+	}
+	if limits.MaxConsecutive > 0 {
+		// grow the stretch of work around the shift as long as other shifts directly adjoin it
+		start, end := *shift.StartTime, *shift.EndTime
+		for grown := true; grown; {
+			grown = false
+			for _, s := range shifts {
+				if s.StartTime == nil || s.EndTime == nil || s.StartTime.After(end) || s.EndTime.Before(start) {
+					continue
+				}
+				if s.StartTime.Before(start) {
+					start, grown = *s.StartTime, true
+				}
+				if s.EndTime.After(end) {
+					end, grown = *s.EndTime, true
+				}
+			}
+		}
+		if end.Sub(start) > limits.MaxConsecutive {
+			return fmt.Errorf("%w: you can work at most %s in a row", ErrSignupLimit, formatDuration(limits.MaxConsecutive))
+		}
+	}
+	return nil
+}
+
+// ##########
+// Handlers
+// ##########
+
+func GetSignupLimits(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limits := models.SignupLimits()
+		c.JSON(http.StatusOK, SignupLimitsOut{
+			MaxPointsPerDay:       limits.MaxPointsPerDay,
+			MaxShiftsPerDay:       limits.MaxShiftsPerDay,
+			MaxConsecutiveMinutes: int(limits.MaxConsecutive.Minutes()),
+			MinRestMinutes:        int(limits.MinRest.Minutes()),
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"sfpr/models"
+	"sfpr/util"
+)
+
+// notifyUsers queues the same notification mail for all given users that have an email address
+func notifyUsers(users []models.User, subject string, text string) {
+	mails := []util.Mail{}
+	for _, user := range users {
+		if user.Username == nil {
+			continue
+		}
+		mails = append(mails, util.NotificationMail(*user.Username, user.Nickname, subject, text))
+	}
+	util.QueueMails(mails)
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+type QualificationCreate struct {
+	Name        string  `json:"name" binding:"required"`
+	Description *string `json:"description"`
+}
+
+type QualificationUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+type UserQualificationUpdate struct {
+	Verified *bool `json:"verified"`
+}
+
+type UserQualificationOut struct {
+	models.UserQualification
+	Nickname string `json:"nickname"`
+}
+
+var ErrNotQualified = errors.New("a qualification required for this shift is missing")
+
+// verifiedQualificationIDs are the qualifications of the user an admin has verified
+func verifiedQualificationIDs(db *gorm.DB, userID uint) ([]uint, error) {
+	ids := []uint{}
+	err := db.Model(&models.UserQualification{}).Where("user_id = ? AND verified", userID).Pluck("qualification_id", &ids).Error
+	return ids, err
+}
+
+// missingQualifications lists the qualifications of the shift that are not in the verified ones
+func missingQualifications(shift models.Shift, verified []uint) []*models.Qualification {
+	missing := []*models.Qualification{}
+	for _, q := range shift.Qualifications {
+		if !slices.Contains(verified, q.ID) {
+			missing = append(missing, q)
+		}
+	}
+	return missing
+}
+
+func qualificationNames(qualifications []*models.Qualification) string {
+	names := make([]string, len(qualifications))
+	for i, q := range qualifications {
+		names[i] = q.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkQualifications returns ErrNotQualified if the user lacks one of the qualifications of the shift
+func checkQualifications(db *gorm.DB, shift models.Shift, userID uint) error {
+	verified, err := verifiedQualificationIDs(db, userID)
+	if err != nil {
+		return err
+	}
+	if missing := missingQualifications(shift, verified); len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotQualified, qualificationNames(missing))
+	}
+	return nil
+}
+
+// qualificationWarnings tells admins which qualifications the user they assigned is missing
+func qualificationWarnings(db *gorm.DB, shift models.Shift, userID uint) []string {
+	warnings := []string{}
+	verified, err := verifiedQualificationIDs(db, userID)
+	if err != nil {
+		return warnings
+	}
+	if missing := missingQualifications(shift, verified); len(missing) > 0 {
+		warnings = append(warnings, "the user lacks qualifications for this shift: "+qualificationNames(missing))
+	}
+	return warnings
+}
+
+// findQualifications loads the qualifications with the given ids, all of them have to exist
+func findQualifications(db *gorm.DB, ids []uint) ([]*models.Qualification, error) {
+	qualifications := []*models.Qualification{}
+	if len(ids) == 0 {
+		return qualifications, nil
+	}
+	if err := db.Find(&qualifications, ids).Error; err != nil {
+		return nil, err
+	}
+	if len(qualifications) != len(ids) {
+		return nil, errors.New("unknown qualification")
+	}
+	return qualifications, nil
+}
+
+// ##########
+// Handlers
+// ##########
+
+func GetQualifications(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var qualifications []models.Qualification
+		if err := db.Order("name asc").Find(&qualifications).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, qualifications)
+	}
+}
+
+func CreateQualification(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var qc QualificationCreate
+		if err := c.ShouldBindJSON(&qc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		qualification := models.Qualification{Name: qc.Name, Description: qc.Description}
+		if err := db.Create(&qualification).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create qualification"})
+			return
+		}
+		c.IndentedJSON(http.StatusCreated, qualification)
+	}
+}
+
+func PutQualification(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var qualification models.Qualification
+		if err := db.First(&qualification, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve qualification."})
+			return
+		}
+		var qu QualificationUpdate
+		if err := c.ShouldBindJSON(&qu); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if qu.Name != nil {
+			qualification.Name = *qu.Name
+		}
+		if qu.Description != nil {
+			qualification.Description = qu.Description
+		}
+		if err := db.Save(&qualification).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save qualification"})
+			return
+		}
+		c.JSON(http.StatusOK, qualification)
+	}
+}
+
+// DeleteQualification removes the qualification from all shifts and users
+func DeleteQualification(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var qualification models.Qualification
+		if err := db.First(&qualification, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve qualification."})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("DELETE FROM shift_qualifications WHERE qualification_id = ?", qualification.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("qualification_id = ?", qualification.ID).Delete(&models.UserQualification{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&qualification).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete qualification"})
+			return
+		}
+		c.JSON(http.StatusOK, qualification)
+	}
+}
+
+// GetQualificationClaims lists the qualifications of all users, ?verified=false only returns the ones
+// still waiting for an admin and ?user=<id> the ones of a single user
+func GetQualificationClaims(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Preload("Qualification").Order("created_at asc")
+		if verified := c.Query("verified"); verified != "" {
+			query = query.Where("verified = ?", verified == "true")
+		}
+		if userID := c.Query("user"); userID != "" {
+			query = query.Where("user_id = ?", userID)
+		}
+		var claims []models.UserQualification
+		if err := query.Find(&claims).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		userIDs := []uint{}
+		for _, claim := range claims {
+			userIDs = append(userIDs, claim.UserID)
+		}
+		var users []models.User
+		if err := db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		nicknames := map[uint]string{}
+		for _, user := range users {
+			nicknames[user.ID] = user.Nickname
+		}
+		out := make([]UserQualificationOut, len(claims))
+		for i, claim := range claims {
+			out[i] = UserQualificationOut{UserQualification: claim, Nickname: nicknames[claim.UserID]}
+		}
+		c.IndentedJSON(http.StatusOK, out)
+	}
+}
+
+// PutUserQualification verifies (or un-verifies) a qualification of a user, admins can also grant
+// qualifications nobody claimed
+func PutUserQualification(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user models.User
+		if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve user."})
+			return
+		}
+		var qualification models.Qualification
+		if err := db.First(&qualification, "id = ?", c.Param("qualification_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve qualification."})
+			return
+		}
+		var uu UserQualificationUpdate
+		if err := c.ShouldBindJSON(&uu); err != nil || uu.Verified == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		adminId, _ := c.Get("user_id")
+
+		claim := models.UserQualification{UserID: user.ID, QualificationID: qualification.ID}
+		if err := db.Where(&claim).FirstOrInit(&claim).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		claim.Verified = *uu.Verified
+		claim.VerifiedAt = nil
+		claim.VerifiedByID = nil
+		if claim.Verified {
+			now := time.Now()
+			adminId2 := adminId.(uint)
+			claim.VerifiedAt = &now
+			claim.VerifiedByID = &adminId2
+		}
+		if err := db.Omit("Qualification").Save(&claim).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save qualification"})
+			return
+		}
+		claim.Qualification = qualification
+		c.JSON(http.StatusOK, UserQualificationOut{UserQualification: claim, Nickname: user.Nickname})
+	}
+}
+
+func DeleteUserQualification(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := db.Where("user_id = ? AND qualification_id = ?", c.Param("id"), c.Param("qualification_id")).
+			Delete(&models.UserQualification{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove qualification"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "The user does not have this qualification"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Qualification removed"})
+	}
+}
+
+func GetMyQualifications(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		var claims []models.UserQualification
+		if err := db.Preload("Qualification").Where("user_id = ?", userId).Order("created_at asc").Find(&claims).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, claims)
+	}
+}
+
+// HandleClaimQualification lets users say they have a qualification, an admin still has to verify it
+func HandleClaimQualification(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		var qualification models.Qualification
+		if err := db.First(&qualification, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve qualification."})
+			return
+		}
+		var count int64
+		db.Model(&models.UserQualification{}).Where("user_id = ? AND qualification_id = ?", userId, qualification.ID).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "You already have this qualification"})
+			return
+		}
+		claim := models.UserQualification{UserID: userId.(uint), QualificationID: qualification.ID}
+		if err := db.Omit("Qualification").Create(&claim).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save qualification"})
+			return
+		}
+		claim.Qualification = qualification
+		c.JSON(http.StatusCreated, claim)
+	}
+}
+
+func HandleRemoveMyQualification(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		result := db.Where("user_id = ? AND qualification_id = ?", userId, c.Param("id")).Delete(&models.UserQualification{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove qualification"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "You do not have this qualification"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Qualification removed"})
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"sfpr/models"
+	"sfpr/util"
+)
+
+type ReminderConfig struct {
+	// how long before the start of a shift its users get reminded, e.g. 12h and 1h
+	Offsets []time.Duration
+	// how long before the start admins hear about shifts that are not full yet, 0 to disable
+	UnderstaffedAlert time.Duration
+	// how often to check for due reminders
+	Interval time.Duration
+}
+
+// claimNotification records a notification and reports whether it was new.
+// Thanks to the unique index this only succeeds once per shift, user and kind.
+func claimNotification(db *gorm.DB, shiftID uint, userID uint, kind string) (bool, error) {
+	notification := models.ShiftNotification{ShiftID: shiftID, UserID: userID, Kind: kind}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&notification)
+	return result.RowsAffected == 1, result.Error
+}
+
+func shiftStartLabel(shift models.Shift) string {
+	return shift.StartTime.In(models.EventLocation()).Format("02.01. um 15:04")
+}
+
+// SendShiftReminders sends all reminders and understaffed alerts that are due at the given time
+// and returns the number of mails sent
+func SendShiftReminders(db *gorm.DB, config ReminderConfig, now time.Time) (int, error) {
+	offsets := append([]time.Duration{}, config.Offsets...)
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+	horizon := config.UnderstaffedAlert
+	if len(offsets) > 0 && offsets[0] > horizon {
+		horizon = offsets[0]
+	}
+	if horizon <= 0 {
+		return 0, nil
+	}
+	// the mails would only be logged, so nothing may be marked as sent yet
+	if !util.EmailsEnabled {
+		return 0, nil
+	}
+
+	var shifts []models.Shift
+	if err := db.Preload("Users").Where("start_time > ? AND start_time <= ?", now, now.Add(horizon)).Find(&shifts).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, shift := range shifts {
+		untilStart := shift.StartTime.Sub(now)
+
+		for _, user := range shift.Users {
+			// if several reminders are due at once (e.g. after a restart) only one mail goes out
+			due := false
+			for _, offset := range offsets {
+				if untilStart > offset {
+					continue
+				}
+				isNew, err := claimNotification(db, shift.ID, user.ID, fmt.Sprintf("reminder-%d", int(offset.Minutes())))
+				if err != nil {
+					return sent, err
+				}
+				due = due || isNew
+			}
+			if due {
+				notifyUsers([]models.User{*user}, "Erinnerung: "+shift.Name,
+					fmt.Sprintf("deine Schicht %s beginnt am %s. Bitte sei pünktlich da!", shift.Name, shiftStartLabel(shift)))
+				sent++
+			}
+		}
+
+		if config.UnderstaffedAlert > 0 && untilStart <= config.UnderstaffedAlert && len(shift.Users) < int(shift.HeadCount) {
+			isNew, err := claimNotification(db, shift.ID, 0, "understaffed")
+			if err != nil {
+				return sent, err
+			}
+			if !isNew {
+				continue
+			}
+			var admins []models.User
+			if err := db.Where("type = ?", "admin").Find(&admins).Error; err != nil {
+				return sent, err
+			}
+			notifyUsers(admins, "Zu wenig Leute: "+shift.Name,
+				fmt.Sprintf("für die Schicht %s am %s sind erst %d von %d Leuten eingetragen.", shift.Name, shiftStartLabel(shift), len(shift.Users), shift.HeadCount))
+			sent += len(admins)
+		}
+	}
+	return sent, nil
+}
+
+// StartShiftReminders checks for due reminders in the background every config.Interval
+func StartShiftReminders(db *gorm.DB, config ReminderConfig) {
+	if len(config.Offsets) == 0 && config.UnderstaffedAlert <= 0 {
+		log.Println("Shift reminders are disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := SendShiftReminders(db, config, time.Now()); err != nil {
+				log.Println("Failed to send shift reminders:", err.Error())
+			}
+			<-ticker.C
+		}
+	}()
+}
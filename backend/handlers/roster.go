@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+// ShiftParticipant is a user in a shift roster. The full name is only there if the viewer may see it.
+type ShiftParticipant struct {
+	ID          uint    `json:"id"`
+	Nickname    string  `json:"nickname"`
+	FullName    *string `json:"fullName"`
+	AvatarUrlSm *string `json:"avatarUrlSm"`
+}
+
+// RosterViewer is whoever looks at a shift roster
+type RosterViewer struct {
+	UserID  uint
+	Admin   bool
+	TeamIDs []uint
+	// verified qualifications, to tell which shifts the viewer may sign up for
+	QualificationIDs []uint
+}
+
+// rosterViewer collects who the current user is, what teams they lead, whether they are an admin
+// and what qualifications they have
+func rosterViewer(c *gin.Context, db *gorm.DB) RosterViewer {
+	viewer := RosterViewer{}
+	if userId, exists := c.Get("user_id"); exists {
+		viewer.UserID = userId.(uint)
+	}
+	viewer.QualificationIDs, _ = verifiedQualificationIDs(db, viewer.UserID)
+	_, isAdmin := c.Get("admin")
+	userType, _ := c.Get("user_type")
+	viewer.Admin = isAdmin || userType == "admin"
+	if viewer.Admin {
+		return viewer
+	}
+	if teamIDs, exists := c.Get("team_ids"); exists {
+		viewer.TeamIDs = teamIDs.([]uint)
+	} else {
+		db.Table("team_leads").Where("user_id = ?", viewer.UserID).Pluck("team_id", &viewer.TeamIDs)
+	}
+	return viewer
+}
+
+// seesFullName is true if the viewer may see the full name of a user in the given shift:
+// their own name, everything for admins, their teams for leads, and users that made their name public
+func (v RosterViewer) seesFullName(shift models.Shift, user *models.User) bool {
+	if v.Admin || v.UserID == user.ID || user.ShowFullName {
+		return true
+	}
+	if shift.TeamID != nil {
+		for _, id := range v.TeamIDs {
+			if id == *shift.TeamID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v RosterViewer) participant(shift models.Shift, user *models.User) ShiftParticipant {
+	participant := ShiftParticipant{
+		ID:          user.ID,
+		Nickname:    user.Nickname,
+		AvatarUrlSm: user.AvatarUrlSm,
+	}
+	if v.seesFullName(shift, user) {
+		participant.FullName = user.FullName
+	}
+	return participant
+}
+
+// displayName is the full name if it may be shown and is known, the nickname otherwise
+func (p ShiftParticipant) displayName() string {
+	if p.FullName != nil && *p.FullName != "" {
+		return *p.FullName
+	}
+	return p.Nickname
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"sfpr/models"
+)
+
+const (
+	RosterAdd    = "add"
+	RosterRemove = "remove"
+	RosterMove   = "move"
+)
+
+type ShiftMove struct {
+	ToShiftID uint `json:"toShiftId" binding:"required"`
+}
+
+// RosterChange is one step of a bulk roster update, ToShiftID is only needed for moves
+type RosterChange struct {
+	Action    string `json:"action" binding:"required"`
+	UserID    uint   `json:"userId" binding:"required"`
+	ShiftID   uint   `json:"shiftId" binding:"required"`
+	ToShiftID uint   `json:"toShiftId"`
+}
+
+type RosterUpdate struct {
+	Changes []RosterChange `json:"changes" binding:"required"`
+	// skip the overlap checks, like ?force=true when adding a single user (admins only)
+	Force bool `json:"force"`
+}
+
+type RosterUpdateOut struct {
+	Shifts []ShiftOut `json:"shifts"`
+	// who was assigned despite their availability, preferences or qualifications
+	Warnings []string `json:"warnings"`
+}
+
+// RosterChangeError tells which change of a bulk update failed
+type RosterChangeError struct {
+	Index int
+	Err   error
+}
+
+func (e *RosterChangeError) Error() string {
+	return fmt.Sprintf("change %d: %s", e.Index+1, e.Err.Error())
+}
+
+func (e *RosterChangeError) Unwrap() error {
+	return e.Err
+}
+
+// lockShifts locks the rows of the shifts in the order of their ids, so that transactions
+// touching the same shifts can't deadlock
+func lockShifts(tx *gorm.DB, shiftIDs ...uint) error {
+	var shifts []models.Shift
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", shiftIDs).Order("id").Find(&shifts).Error
+}
+
+// MoveUserBetweenShifts takes the user out of one shift and puts them into another one. If they
+// can't be added (full, overlapping) they keep their old seat, otherwise the old seat goes to the standby list.
+func MoveUserBetweenShifts(db *gorm.DB, fromShiftID, toShiftID, userID uint, force bool) error {
+	var fromShift models.Shift
+	var promoted []models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockShifts(tx, fromShiftID, toShiftID); err != nil {
+			return err
+		}
+		if err := moveUserBetweenShifts(tx, fromShiftID, toShiftID, userID, force); err != nil {
+			return err
+		}
+		var err error
+		fromShift, promoted, err = promoteStandby(tx, fromShiftID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	notifyPromoted(fromShift, promoted)
+	return nil
+}
+
+func moveUserBetweenShifts(tx *gorm.DB, fromShiftID, toShiftID, userID uint, force bool) error {
+	if fromShiftID == toShiftID {
+		return ErrAlreadyInShift
+	}
+	if err := removeUserFromShift(tx, fromShiftID, userID); err != nil {
+		return err
+	}
+	return AddUserToShift(tx, toShiftID, userID, false, force)
+}
+
+// ApplyRosterChanges applies all changes in order in one transaction, if one fails none are applied.
+// Seats that are still free at the end go to the standby lists.
+func ApplyRosterChanges(db *gorm.DB, changes []RosterChange, force bool) error {
+	shiftIDs := []uint{}
+	for _, change := range changes {
+		shiftIDs = append(shiftIDs, change.ShiftID)
+		if change.Action == RosterMove {
+			shiftIDs = append(shiftIDs, change.ToShiftID)
+		}
+	}
+	shifts := []models.Shift{}
+	promoted := [][]models.User{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockShifts(tx, shiftIDs...); err != nil {
+			return err
+		}
+		for i, change := range changes {
+			var err error
+			switch change.Action {
+			case RosterAdd:
+				err = AddUserToShift(tx, change.ShiftID, change.UserID, false, force)
+			case RosterRemove:
+				err = removeUserFromShift(tx, change.ShiftID, change.UserID)
+			case RosterMove:
+				err = moveUserBetweenShifts(tx, change.ShiftID, change.ToShiftID, change.UserID, force)
+			default:
+				err = fmt.Errorf("unknown action %s", change.Action)
+			}
+			if err != nil {
+				return &RosterChangeError{Index: i, Err: err}
+			}
+		}
+		seen := map[uint]bool{}
+		for _, id := range shiftIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			shift, users, err := promoteStandby(tx, id)
+			if err != nil {
+				return err
+			}
+			shifts = append(shifts, shift)
+			promoted = append(promoted, users)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, shift := range shifts {
+		notifyPromoted(shift, promoted[i])
+	}
+	return nil
+}
+
+// rosterWarnings collects the warnings for a user that was added to a shift by an admin or lead
+func rosterWarnings(db *gorm.DB, shift models.Shift, userID uint) []string {
+	warnings := []string{}
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return warnings
+	}
+	for _, warning := range assignmentWarnings(db, shift, userID) {
+		warnings = append(warnings, fmt.Sprintf("%s in %s: %s", user.Nickname, shiftLabel(shift), warning))
+	}
+	return warnings
+}
+
+// ##########
+// Handlers
+// ##########
+
+// HandleMoveUserToShift moves a user from the shift in the path to the shift in the body
+func HandleMoveUserToShift(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDUint, _ := strconv.ParseUint(c.Param("user_id"), 10, 32)
+		// only admins may ignore overlapping shifts
+		_, isAdmin := c.Get("admin")
+		force := isAdmin && c.Query("force") == "true"
+		var sm ShiftMove
+		if err := c.ShouldBindJSON(&sm); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		fromShift, err := GetShiftById(db, c.Param("shift_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		toShift, err := GetShiftById(db, strconv.FormatUint(uint64(sm.ToShiftID), 10))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		if !canManageTeam(c, fromShift.TeamID) || !canManageTeam(c, toShift.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only staff shifts of your own teams."})
+			return
+		}
+
+		if err := MoveUserBetweenShifts(db, fromShift.ID, toShift.ID, uint(userIDUint), force); err != nil {
+			c.JSON(shiftErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		viewer := rosterViewer(c, db)
+		fromShift, _ = GetShiftById(db, c.Param("shift_id"))
+		toShift, _ = GetShiftById(db, strconv.FormatUint(uint64(sm.ToShiftID), 10))
+		c.JSON(http.StatusOK, RosterUpdateOut{
+			Shifts:   []ShiftOut{ShiftToOut(fromShift, viewer), ShiftToOut(toShift, viewer)},
+			Warnings: rosterWarnings(db, toShift, uint(userIDUint)),
+		})
+	}
+}
+
+// HandleUpdateRoster applies a list of adds, removes and moves at once, e.g. from a roster board.
+// If a change fails nothing is saved and the error names the failing change.
+func HandleUpdateRoster(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ru RosterUpdate
+		if err := c.ShouldBindJSON(&ru); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		touched := []uint{}
+		seen := map[uint]bool{}
+		for _, change := range ru.Changes {
+			for _, id := range []uint{change.ShiftID, change.ToShiftID} {
+				if id != 0 && !seen[id] {
+					seen[id] = true
+					touched = append(touched, id)
+				}
+			}
+		}
+		var shifts []models.Shift
+		if err := db.Preload("Qualifications").Where("id IN ?", touched).Find(&shifts).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		if len(shifts) != len(touched) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		for _, shift := range shifts {
+			if !canManageTeam(c, shift.TeamID) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You can only staff shifts of your own teams."})
+				return
+			}
+		}
+
+		_, isAdmin := c.Get("admin")
+		if err := ApplyRosterChanges(db, ru.Changes, isAdmin && ru.Force); err != nil {
+			response := gin.H{"error": err.Error()}
+			var changeErr *RosterChangeError
+			if errors.As(err, &changeErr) {
+				response["index"] = changeErr.Index
+			}
+			c.JSON(shiftErrorStatus(err), response)
+			return
+		}
+
+		out := RosterUpdateOut{Shifts: []ShiftOut{}, Warnings: []string{}}
+		viewer := rosterViewer(c, db)
+		for _, id := range touched {
+			shift, err := GetShiftById(db, strconv.FormatUint(uint64(id), 10))
+			if err != nil {
+				continue
+			}
+			out.Shifts = append(out.Shifts, ShiftToOut(shift, viewer))
+		}
+		for _, change := range ru.Changes {
+			shiftID := change.ShiftID
+			if change.Action == RosterMove {
+				shiftID = change.ToShiftID
+			}
+			if change.Action == RosterRemove {
+				continue
+			}
+			for _, shift := range shifts {
+				if shift.ID == shiftID {
+					out.Warnings = append(out.Warnings, rosterWarnings(db, shift, change.UserID)...)
+				}
+			}
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
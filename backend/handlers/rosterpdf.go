@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+// rosterGroup is one printed section of the roster, usually an event day
+type rosterGroup struct {
+	title  string
+	shifts []models.Shift
+}
+
+const (
+	rosterMargin    = 12.0
+	rosterRowHeight = 7.0
+	rosterColNo     = 10.0
+	rosterColName   = 75.0
+	rosterColPhone  = 50.0
+)
+
+// rosterDayTitle is the heading a shift is printed under
+func rosterDayTitle(shift models.Shift) string {
+	if shift.Day != nil {
+		if day, ok := models.FindEventDay(*shift.Day); ok {
+			return fmt.Sprintf("%s, %s", day.Name, day.Date.Format("02.01.2006"))
+		}
+		return *shift.Day
+	}
+	if shift.StartTime != nil {
+		return shift.StartTime.In(models.EventLocation()).Format("02.01.2006")
+	}
+	return "Ohne Tag"
+}
+
+func rosterTime(shift models.Shift) string {
+	if shift.StartTime == nil {
+		return "--:--"
+	}
+	label := shift.StartTime.In(models.EventLocation()).Format("15:04")
+	if shift.EndTime != nil {
+		label += " - " + shift.EndTime.In(models.EventLocation()).Format("15:04")
+	}
+	return label
+}
+
+// groupRoster splits the shifts into one group per day, in the order of the shifts
+func groupRoster(shifts []models.Shift) []rosterGroup {
+	groups := []rosterGroup{}
+	index := map[string]int{}
+	for _, shift := range shifts {
+		title := rosterDayTitle(shift)
+		i, exists := index[title]
+		if !exists {
+			i = len(groups)
+			index[title] = i
+			groups = append(groups, rosterGroup{title: title})
+		}
+		groups[i].shifts = append(groups[i].shifts, shift)
+	}
+	return groups
+}
+
+// RenderRosterPDF lays out the shifts for printing: one page (or more) per day, every shift with its
+// people, their phone numbers and empty lines for the free seats
+func RenderRosterPDF(title string, shifts []models.Shift, teams map[uint]string) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(rosterMargin, rosterMargin, rosterMargin)
+	pdf.SetAutoPageBreak(true, rosterMargin)
+	// the core fonts only know cp1252, which is enough for german umlauts
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	_, pageHeight := pdf.GetPageSize()
+	printed := time.Now().In(models.EventLocation()).Format("02.01.2006 15:04")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-rosterMargin + 2)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 5, tr(fmt.Sprintf("Stand: %s - Seite %d", printed, pdf.PageNo())), "", 0, "R", false, 0, "")
+	})
+
+	groups := groupRoster(shifts)
+	if len(groups) == 0 {
+		groups = append(groups, rosterGroup{title: "Keine Schichten"})
+	}
+	for _, group := range groups {
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "B", 16)
+		pdf.CellFormat(0, 9, tr(title), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 12)
+		pdf.CellFormat(0, 7, tr(group.title), "", 1, "L", false, 0, "")
+		pdf.Ln(3)
+
+		for _, shift := range group.shifts {
+			rows := int(shift.HeadCount)
+			if len(shift.Users) > rows {
+				rows = len(shift.Users)
+			}
+			// keep a shift on one page if it fits
+			needed := float64(rows+2) * rosterRowHeight
+			if pdf.GetY()+needed > pageHeight-rosterMargin-5 {
+				pdf.AddPage()
+			}
+
+			heading := fmt.Sprintf("%s  %s", rosterTime(shift), shift.Name)
+			if shift.TeamID != nil && teams[*shift.TeamID] != "" {
+				heading += " (" + teams[*shift.TeamID] + ")"
+			}
+			pdf.SetFont("Helvetica", "B", 11)
+			pdf.SetFillColor(230, 230, 230)
+			pdf.CellFormat(0, rosterRowHeight, tr(heading), "1", 1, "L", true, 0, "")
+			pdf.SetFont("Helvetica", "", 9)
+			details := fmt.Sprintf("%d von %d Leuten, %d Punkt(e)", len(shift.Users), shift.HeadCount, shift.Points)
+			if shift.Description != nil && *shift.Description != "" {
+				details += " - " + *shift.Description
+			}
+			pdf.CellFormat(0, rosterRowHeight-1, tr(details), "LR", 1, "L", false, 0, "")
+
+			pdf.SetFont("Helvetica", "", 10)
+			for i := 0; i < rows; i++ {
+				name, phone := "", ""
+				if i < len(shift.Users) {
+					user := shift.Users[i]
+					name = user.Nickname
+					if user.FullName != nil && *user.FullName != "" {
+						name = fmt.Sprintf("%s (%s)", *user.FullName, user.Nickname)
+					}
+					if user.Phone != nil {
+						phone = *user.Phone
+					}
+				} else {
+					// free seat, to write in by hand
+					name = "frei"
+					pdf.SetTextColor(150, 150, 150)
+				}
+				pdf.CellFormat(rosterColNo, rosterRowHeight, fmt.Sprintf("%d", i+1), "1", 0, "C", false, 0, "")
+				pdf.CellFormat(rosterColName, rosterRowHeight, tr(name), "1", 0, "L", false, 0, "")
+				pdf.CellFormat(rosterColPhone, rosterRowHeight, tr(phone), "1", 0, "L", false, 0, "")
+				// room to tick off who showed up
+				pdf.CellFormat(0, rosterRowHeight, "", "1", 1, "L", false, 0, "")
+				pdf.SetTextColor(0, 0, 0)
+			}
+			pdf.Ln(4)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ##########
+// Handlers
+// ##########
+
+// HandleGetRosterPDF renders the shifts of a day (?day=Samstag or ?day=2025-06-07) and/or a team (?team=3)
+// as a printable PDF. Team leads only get the rosters of their own teams.
+func HandleGetRosterPDF(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Preload("Users", func(db *gorm.DB) *gorm.DB { return db.Order("nickname asc") })
+		title := "Schichtplan"
+
+		if dayParam := c.Query("day"); dayParam != "" {
+			day, ok := models.FindEventDay(dayParam)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown day"})
+				return
+			}
+			query = whereEventDay(query, day)
+		}
+
+		teamNames := map[uint]string{}
+		var teams []models.Team
+		if err := db.Find(&teams).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		for _, team := range teams {
+			teamNames[team.ID] = team.Name
+		}
+
+		if teamParam := c.Query("team"); teamParam != "" {
+			team, err := GetTeamById(db, teamParam)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Unknown team"})
+				return
+			}
+			if !canManageTeam(c, &team.ID) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You can only print the rosters of your own teams."})
+				return
+			}
+			query = query.Where("team_id = ?", team.ID)
+			title += " " + team.Name
+		} else if _, isAdmin := c.Get("admin"); !isAdmin {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Please choose one of your teams"})
+			return
+		}
+
+		var shifts []models.Shift
+		if err := query.Order("start_time asc nulls last").Order("name").Find(&shifts).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		// shifts without a day come last
+		sort.SliceStable(shifts, func(i, j int) bool {
+			return shifts[i].Day != nil && shifts[j].Day == nil
+		})
+
+		pdfBytes, err := RenderRosterPDF(title, shifts, teamNames)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render roster"})
+			return
+		}
+		c.Header("Content-Disposition", `inline; filename="schichtplan.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", pdfBytes)
+	}
+}
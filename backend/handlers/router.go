@@ -50,6 +50,7 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 	api.GET("/verify", Verify(db))
 	api.POST("/requestPasswordReset", RequestPWReset(db))
 	api.POST("/resetPassword", ResetPW(db))
+	api.GET("/calendar/:token", GetCalendarFeed(db))
 
 	// in DEV/TEST the backend hosts the avatars
 	// in PROD Caddy handles this
@@ -68,20 +69,73 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 	protected.PUT("/me", PutMe(db))
 	protected.PUT("/me/pw", PutMePW(db))
 	protected.PUT("/me/avatar", UploadAvatar(db))
+	protected.GET("/me/calendar", GetMyCalendar(db))
+	protected.POST("/me/calendar", ResetMyCalendar(db))
+	protected.DELETE("/me/calendar", DeleteMyCalendar(db))
+	protected.GET("/me/availability", GetMyAvailability(db))
+	protected.PUT("/me/availability", PutMyAvailability(db))
+	protected.GET("/leaderboard", HandleGetLeaderboard(db))
+	protected.GET("/signuplimits", GetSignupLimits(db))
+	protected.GET("/qualifications", GetQualifications(db))
+	protected.GET("/qualifications/", GetQualifications(db))
+	protected.GET("/me/qualifications", GetMyQualifications(db))
+	protected.POST("/me/qualifications/:id", HandleClaimQualification(db))
+	protected.DELETE("/me/qualifications/:id", HandleRemoveMyQualification(db))
+	protected.GET("/eventdays", GetEventDays(db))
 	protected.GET("/spots", GetSpots(db))
 	protected.GET("/spots/", GetSpots(db))
 	protected.GET("/shifts", HandleGetShifts(db))
 	protected.GET("/shifts/", HandleGetShifts(db))
+	protected.GET("/shiftcategories", GetShiftCategories(db))
+	protected.GET("/shiftcategories/", GetShiftCategories(db))
+	protected.GET("/shiftlocations", GetShiftLocations(db))
+	protected.GET("/shiftlocations/", GetShiftLocations(db))
 	protected.GET("/users", GetUsersShort(db))
 	protected.GET("/users/", GetUsersShort(db))
 	protected.POST("/shifts/:shift_id/me", HandleAddMeToShift(db))
 	protected.DELETE("/shifts/:shift_id/me", HandleRemoveMeFromShift(db))
+	protected.POST("/shifts/:shift_id/swap", HandleCreateSwap(db))
+	protected.POST("/shifts/:shift_id/standby", HandleJoinStandby(db))
+	protected.DELETE("/shifts/:shift_id/standby", HandleLeaveStandby(db))
+	protected.POST("/shifts/:shift_id/buddy", HandleCreateBuddy(db))
+	protected.GET("/swaps", HandleGetSwaps(db))
+	protected.GET("/swaps/", HandleGetSwaps(db))
+	protected.POST("/swaps/:id/accept", HandleAcceptSwap(db))
+	protected.DELETE("/swaps/:id", HandleCancelSwap(db))
+	protected.GET("/buddies", HandleGetBuddies(db))
+	protected.GET("/buddies/", HandleGetBuddies(db))
+	protected.POST("/buddies/:id/confirm", HandleConfirmBuddy(db))
+	protected.DELETE("/buddies/:id", HandleDeleteBuddy(db))
+	protected.GET("/announcements", GetAnnouncements(db))
+	protected.GET("/announcements/", GetAnnouncements(db))
+
+	// team leads can manage the shifts of their own teams
+	lead := api.Group("/lead")
+	lead.Use(middleware.TeamLeadMiddleware(db))
+
+	lead.GET("/teams", GetTeams(db))
+	lead.GET("/teams/", GetTeams(db))
+	lead.GET("/shifts", HandleGetShifts(db))
+	lead.GET("/shifts/", HandleGetShifts(db))
+	lead.POST("/shifts", HandleCreateShift(db))
+	lead.POST("/shifts/", HandleCreateShift(db))
+	lead.GET("/shifts/roster.pdf", HandleGetRosterPDF(db))
+	lead.GET("/shifts/:shift_id/candidates", HandleGetShiftCandidates(db))
+	lead.POST("/shifts/:shift_id/user/:user_id", HandleAddUserToShift(db))
+	lead.POST("/shifts/:shift_id/user/:user_id/move", HandleMoveUserToShift(db))
+	lead.POST("/roster", HandleUpdateRoster(db))
+	lead.DELETE("/shifts/:shift_id", HandleDeleteshift(db))
+	lead.DELETE("/shifts/:shift_id/user/:user_id", HandleRemoveUserFromShift(db))
+	lead.GET("/shifts/:shift_id/attendance", HandleGetShiftAttendance(db))
+	lead.PUT("/shifts/:shift_id/user/:user_id/attendance", HandleSetAttendance(db))
+	lead.PUT("/shifts/:shift_id", HandlePutShift(db))
 
 	admin := api.Group("/admin")
 	admin.Use(middleware.AdminMiddleware(db))
 
 	admin.GET("/users", GetUsers(db))
 	admin.GET("/users/", GetUsers(db))
+	admin.GET("/users/quota", GetUsersBelowQuota(db))
 	admin.POST("/users", CreateUser(db))
 	admin.POST("/users/", CreateUser(db))
 	admin.PUT("/users/:id", PutUser(db))
@@ -100,9 +154,68 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 	admin.POST("/shifts", HandleCreateShift(db))
 	admin.POST("/shifts/", HandleCreateShift(db))
 	admin.POST("/shifts/import", ImportShiftsFromCSV(db))
+	admin.GET("/shifts/export", ExportShifts(db))
+	admin.GET("/shifts/roster.pdf", HandleGetRosterPDF(db))
+	admin.GET("/shifts/conflicts", HandleGetShiftConflicts(db))
+	admin.GET("/shifts/noshows", GetNoShowReport(db))
+	admin.GET("/shifts/stats", HandleGetCrewStats(db))
+	admin.POST("/shifts/autoassign/preview", HandleAutoAssignPreview(db))
+	admin.POST("/shifts/autoassign/apply", HandleAutoAssignApply(db))
+	admin.GET("/shifts/:shift_id/candidates", HandleGetShiftCandidates(db))
 	admin.POST("/shifts/:shift_id/user/:user_id", HandleAddUserToShift(db))
+	admin.POST("/shifts/:shift_id/user/:user_id/move", HandleMoveUserToShift(db))
+	admin.POST("/roster", HandleUpdateRoster(db))
 	admin.DELETE("/shifts/:shift_id", HandleDeleteshift(db))
 	admin.DELETE("/shifts/:shift_id/user/:user_id", HandleRemoveUserFromShift(db))
-	admin.PUT("/shifts/:id", HandlePutShift(db))
+	admin.GET("/shifts/:shift_id/attendance", HandleGetShiftAttendance(db))
+	admin.PUT("/shifts/:shift_id/user/:user_id/attendance", HandleSetAttendance(db))
+	admin.PUT("/shifts/:shift_id", HandlePutShift(db))
+
+	admin.GET("/shifttemplates", GetShiftTemplates(db))
+	admin.GET("/shifttemplates/", GetShiftTemplates(db))
+	admin.POST("/shifttemplates", CreateShiftTemplate(db))
+	admin.POST("/shifttemplates/", CreateShiftTemplate(db))
+	admin.PUT("/shifttemplates/:id", PutShiftTemplate(db))
+	admin.DELETE("/shifttemplates/:id", DeleteShiftTemplate(db))
+
+	admin.GET("/shiftcategories", GetShiftCategories(db))
+	admin.GET("/shiftcategories/", GetShiftCategories(db))
+	admin.POST("/shiftcategories", CreateShiftCategory(db))
+	admin.POST("/shiftcategories/", CreateShiftCategory(db))
+	admin.PUT("/shiftcategories/:id", PutShiftCategory(db))
+	admin.DELETE("/shiftcategories/:id", DeleteShiftCategory(db))
+
+	admin.GET("/shiftlocations", GetShiftLocations(db))
+	admin.GET("/shiftlocations/", GetShiftLocations(db))
+	admin.POST("/shiftlocations", CreateShiftLocation(db))
+	admin.POST("/shiftlocations/", CreateShiftLocation(db))
+	admin.PUT("/shiftlocations/:id", PutShiftLocation(db))
+	admin.DELETE("/shiftlocations/:id", DeleteShiftLocation(db))
+
+	admin.GET("/qualifications", GetQualifications(db))
+	admin.GET("/qualifications/", GetQualifications(db))
+	admin.POST("/qualifications", CreateQualification(db))
+	admin.POST("/qualifications/", CreateQualification(db))
+	admin.GET("/qualifications/claims", GetQualificationClaims(db))
+	admin.PUT("/qualifications/:id", PutQualification(db))
+	admin.DELETE("/qualifications/:id", DeleteQualification(db))
+	admin.PUT("/users/:id/qualifications/:qualification_id", PutUserQualification(db))
+	admin.DELETE("/users/:id/qualifications/:qualification_id", DeleteUserQualification(db))
+
+	admin.GET("/teams", GetTeams(db))
+	admin.GET("/teams/", GetTeams(db))
+	admin.POST("/teams", CreateTeam(db))
+	admin.POST("/teams/", CreateTeam(db))
+	admin.PUT("/teams/:id", PutTeam(db))
+	admin.DELETE("/teams/:id", DeleteTeam(db))
+	admin.POST("/teams/:id/leads/:user_id", AddTeamLead(db))
+	admin.DELETE("/teams/:id/leads/:user_id", RemoveTeamLead(db))
+
+	admin.GET("/announcements", GetAllAnnouncements(db))
+	admin.GET("/announcements/", GetAllAnnouncements(db))
+	admin.POST("/announcements", CreateAnnouncement(db))
+	admin.POST("/announcements/", CreateAnnouncement(db))
+	admin.PUT("/announcements/:id", PutAnnouncement(db))
+	admin.DELETE("/announcements/:id", DeleteAnnouncement(db))
 	return r
 }
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+	"sfpr/util"
+)
+
+// the same columns ImportShiftsFromCSV reads, so an export can be edited and imported again
+var shiftExportHeaders = []string{"key", "day", "starttime", "endtime", "name", "description", "headcount", "points"}
+
+// shiftExportRows turns the shifts into rows for a sheet, starting with the header row
+func shiftExportRows(shifts []models.Shift) [][]string {
+	loc := models.EventLocation()
+	rows := [][]string{shiftExportHeaders}
+	for _, shift := range shifts {
+		key := fmt.Sprintf("#%d", shift.ID)
+		if shift.ExternalKey != nil {
+			key = *shift.ExternalKey
+		}
+		day, start, end, description := "", "", "", ""
+		if shift.Day != nil {
+			day = *shift.Day
+		} else if shift.StartTime != nil {
+			// shifts from the API only have a start time, the import needs the day for it
+			day = shift.StartTime.In(loc).Format("2006-01-02")
+			if eventDay, ok := models.FindEventDay(day); ok {
+				day = eventDay.Name
+			}
+		}
+		if shift.StartTime != nil {
+			start = shift.StartTime.In(loc).Format("15:04")
+		}
+		if shift.EndTime != nil {
+			end = shift.EndTime.In(loc).Format("15:04")
+		}
+		if shift.Description != nil {
+			description = *shift.Description
+		}
+		rows = append(rows, []string{
+			key,
+			day,
+			start,
+			end,
+			shift.Name,
+			description,
+			fmt.Sprintf("%d", shift.HeadCount),
+			fmt.Sprintf("%d", shift.Points),
+		})
+	}
+	return rows
+}
+
+// ExportShifts returns all shifts as CSV or, with ?format=xlsx, as an Excel sheet
+func ExportShifts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var shifts []models.Shift
+		if err := db.Order("start_time asc nulls last").Order("id").Find(&shifts).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		rows := shiftExportRows(shifts)
+
+		switch c.DefaultQuery("format", "csv") {
+		case "csv":
+			var buf bytes.Buffer
+			w := csv.NewWriter(&buf)
+			if err := w.WriteAll(rows); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write CSV"})
+				return
+			}
+			c.Header("Content-Disposition", `attachment; filename="schichten.csv"`)
+			c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		case "xlsx":
+			data, err := util.XLSX("Schichten", rows)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write XLSX"})
+				return
+			}
+			c.Header("Content-Disposition", `attachment; filename="schichten.xlsx"`)
+			c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", data)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		}
+	}
+}
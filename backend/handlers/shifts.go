@@ -5,12 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"sfpr/models"
 	"sfpr/util"
@@ -23,6 +25,18 @@ type ShiftUpdate struct {
 	Description *string    `json:"description"`
 	Day         *string    `json:"day"`
 	StartTime   *time.Time `json:"startTime" time_format:"2006-01-02T15:00:00"`
+	EndTime     *time.Time `json:"endTime" time_format:"2006-01-02T15:00:00"`
+	TeamID      *uint      `json:"teamId"`
+
+	RemovalDeadline  *time.Time `json:"removalDeadline"`
+	SignupClosed     *bool      `json:"signupClosed"`
+	QualificationIDs *[]uint    `json:"qualificationIds"`
+
+	// 0 removes the category or location
+	CategoryID   *uint   `json:"categoryId"`
+	LocationID   *uint   `json:"locationId"`
+	ContactName  *string `json:"contactName"`
+	ContactPhone *string `json:"contactPhone"`
 }
 
 type ShiftCreate struct {
@@ -32,6 +46,18 @@ type ShiftCreate struct {
 	Description *string    `json:"description"`
 	Day         *string    `json:"day"`
 	StartTime   *time.Time `json:"startTime" time_format:"2006-01-02T15:00:00"`
+	EndTime     *time.Time `json:"endTime" time_format:"2006-01-02T15:00:00"`
+	TeamID      *uint      `json:"teamId"`
+
+	RemovalDeadline  *time.Time `json:"removalDeadline"`
+	SignupClosed     *bool      `json:"signupClosed"`
+	QualificationIDs *[]uint    `json:"qualificationIds"`
+
+	// 0 removes the category or location
+	CategoryID   *uint   `json:"categoryId"`
+	LocationID   *uint   `json:"locationId"`
+	ContactName  *string `json:"contactName"`
+	ContactPhone *string `json:"contactPhone"`
 }
 
 type ShiftOut struct {
@@ -42,121 +68,458 @@ type ShiftOut struct {
 	Day          *string    `json:"day"`
 	Description  *string    `json:"description"`
 	StartTime    *time.Time `json:"startTime"`
+	EndTime      *time.Time `json:"endTime"`
+	TeamID       *uint      `json:"teamId"`
+	TemplateID   *uint      `json:"templateId"`
+	CategoryID   *uint      `json:"categoryId"`
+	LocationID   *uint      `json:"locationId"`
+	ContactName  *string    `json:"contactName"`
+	ContactPhone *string    `json:"contactPhone"`
 	CurrentCount uint8      `json:"currentCount"`
-	UserNames    *[]string  `json:"userNames"`
+	// Deprecated: use Participants. Display names, the full name only where the viewer may see it.
+	UserNames    *[]string          `json:"userNames"`
+	Participants []ShiftParticipant `json:"participants"`
+	StandbyCount int                `json:"standbyCount"`
+	// position of the current user on the standby list, starting at 1
+	StandbyPosition *int `json:"standbyPosition"`
+	// the effective deadline for leaving the shift, from the shift itself or the global cutoff
+	RemovalDeadline *time.Time              `json:"removalDeadline"`
+	SignupClosed    bool                    `json:"signupClosed"`
+	Qualifications  []*models.Qualification `json:"qualifications"`
+	// true if the current user has all qualifications needed for the shift
+	Eligible bool `json:"eligible"`
+	// the markdown description as sanitised HTML
+	DescriptionHTML *string `json:"descriptionHtml"`
+	// only set when an admin assigns someone who does not want to or cannot do the shift
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+const (
+	ImportCreate = "create"
+	ImportUpdate = "update"
+	ImportError  = "error"
+)
+
+type ShiftImportRow struct {
+	Row    int     `json:"row"`
+	Key    *string `json:"key"`
+	Name   string  `json:"name"`
+	Action string  `json:"action"`
+	Error  *string `json:"error,omitempty"`
+}
+
+type ShiftImportResult struct {
+	Message string           `json:"message"`
+	DryRun  bool             `json:"dryRun"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Failed  int              `json:"failed"`
+	Rows    []ShiftImportRow `json:"rows"`
 }
 
 // CRUD
 
 func GetShiftById(db *gorm.DB, id string) (models.Shift, error) {
 	var shiftExist models.Shift
-	if err := db.Preload("Users").First(&shiftExist, "id = ?", id).Error; err != nil {
+	if err := db.Preload("Users").Preload("Qualifications").First(&shiftExist, "id = ?", id).Error; err != nil {
 		return shiftExist, err
 	}
 	return shiftExist, nil
 }
 
-func ShiftToOut(shift models.Shift) ShiftOut {
-	var userNames []string
+// ShiftToOut turns a shift with its users into the roster the viewer is allowed to see
+func ShiftToOut(shift models.Shift, viewer RosterViewer) ShiftOut {
+	userNames := []string{}
+	participants := []ShiftParticipant{}
 	var shiftWithUserNames ShiftOut
 	for _, user := range shift.Users {
-		userNames = append(userNames, *user.FullName)
+		participant := viewer.participant(shift, user)
+		participants = append(participants, participant)
+		userNames = append(userNames, participant.displayName())
 	}
 
 	shiftWithUserNames = ShiftOut{
 		ID:           shift.ID,
 		Name:         shift.Name,
 		StartTime:    shift.StartTime,
+		EndTime:      shift.EndTime,
+		TeamID:       shift.TeamID,
+		TemplateID:   shift.TemplateID,
+		CategoryID:   shift.CategoryID,
+		LocationID:   shift.LocationID,
+		ContactName:  shift.ContactName,
+		ContactPhone: shift.ContactPhone,
 		Points:       shift.Points,
 		Description:  shift.Description,
 		Day:          shift.Day,
 		HeadCount:    shift.HeadCount,
 		CurrentCount: uint8(len(userNames)),
 		UserNames:    &userNames,
+		Participants: participants,
+
+		RemovalDeadline: shift.SelfRemovalDeadline(),
+		SignupClosed:    shift.SelfSignupClosed(),
+		Qualifications:  shift.Qualifications,
+		Eligible:        len(missingQualifications(shift, viewer.QualificationIDs)) == 0,
+		DescriptionHTML: util.RenderOptionalMarkdown(shift.Description),
+	}
+	if shiftWithUserNames.Qualifications == nil {
+		shiftWithUserNames.Qualifications = []*models.Qualification{}
 	}
 	return shiftWithUserNames
 }
 
-func GetShiftsWithUserNames(db *gorm.DB) ([]ShiftOut, error) {
+// ShiftFilter narrows down and orders the shift list, the zero value lists all shifts
+type ShiftFilter struct {
+	Day        *models.EventDay
+	CategoryID *uint
+	LocationID *uint
+	// only shifts with a free seat
+	Free bool
+	// only shifts the viewer is signed up for
+	Mine bool
+	// one of shiftSorts, unordered if empty
+	Sort string
+}
+
+// shiftSorts are the orders the shift list can be sorted by, "-" in front reverses them
+var shiftSorts = map[string]string{
+	"start":  "start_time asc nulls last, name",
+	"-start": "start_time desc nulls last, name",
+	"name":   "name, start_time",
+	"-name":  "name desc, start_time",
+	"free":   "head_count - (SELECT count(*) FROM shift_users WHERE shift_users.shift_id = shifts.id) desc, start_time",
+	"-free":  "head_count - (SELECT count(*) FROM shift_users WHERE shift_users.shift_id = shifts.id) asc, start_time",
+}
+
+// parseShiftFilter reads ?day, ?category, ?location, ?free, ?mine and ?sort
+func parseShiftFilter(c *gin.Context) (ShiftFilter, error) {
+	filter := ShiftFilter{
+		Free: c.Query("free") == "true",
+		Mine: c.Query("mine") == "true",
+		Sort: c.Query("sort"),
+	}
+	if dayParam := c.Query("day"); dayParam != "" {
+		day, ok := models.FindEventDay(dayParam)
+		if !ok {
+			return filter, fmt.Errorf("invalid day %s. Must be one of [%s]", dayParam, strings.Join(models.EventDayNames(), ", "))
+		}
+		filter.Day = &day
+	}
+	for param, target := range map[string]**uint{"category": &filter.CategoryID, "location": &filter.LocationID} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s %s", param, value)
+			}
+			idUint := uint(id)
+			*target = &idUint
+		}
+	}
+	if _, known := shiftSorts[filter.Sort]; filter.Sort != "" && !known {
+		return filter, fmt.Errorf("can't sort by %s", filter.Sort)
+	}
+	return filter, nil
+}
+
+// whereEventDay limits a shift query to an event day. Shifts belong to a day by name, or by their start if they have none.
+func whereEventDay(query *gorm.DB, day models.EventDay) *gorm.DB {
+	nextDay := day.Date.AddDate(0, 0, 1)
+	return query.Where("day = ? OR (day IS NULL AND start_time >= ? AND start_time < ?)", day.Name, day.Date, nextDay)
+}
+
+func (f ShiftFilter) apply(query *gorm.DB, viewer RosterViewer) *gorm.DB {
+	if f.Day != nil {
+		query = whereEventDay(query, *f.Day)
+	}
+	if f.CategoryID != nil {
+		query = query.Where("category_id = ?", *f.CategoryID)
+	}
+	if f.LocationID != nil {
+		query = query.Where("location_id = ?", *f.LocationID)
+	}
+	if f.Free {
+		query = query.Where("head_count > (SELECT count(*) FROM shift_users WHERE shift_users.shift_id = shifts.id)")
+	}
+	if f.Mine {
+		query = query.Where("id IN (SELECT shift_id FROM shift_users WHERE user_id = ?)", viewer.UserID)
+	}
+	if order, known := shiftSorts[f.Sort]; known {
+		query = query.Order(order)
+	}
+	return query
+}
+
+// GetShiftsWithUserNames loads the shifts matching the filter as the viewer may see them, with their standby list positions
+func GetShiftsWithUserNames(db *gorm.DB, viewer RosterViewer, filter ShiftFilter) ([]ShiftOut, error) {
 	var shifts []models.Shift
-	var shiftsWithUserNames []ShiftOut
+	shiftsWithUserNames := []ShiftOut{}
 
 	// First, load shifts with their users
-	if err := db.Preload("Users").Find(&shifts).Error; err != nil {
+	if err := filter.apply(db.Preload("Users").Preload("Qualifications"), viewer).Find(&shifts).Error; err != nil {
 		return nil, err
 	}
+	var standbys []models.ShiftStandby
+	if err := db.Order("created_at, id").Find(&standbys).Error; err != nil {
+		return nil, err
+	}
+	standbyCount := map[uint]int{}
+	standbyPosition := map[uint]int{}
+	for _, s := range standbys {
+		standbyCount[s.ShiftID]++
+		if s.UserID == viewer.UserID {
+			standbyPosition[s.ShiftID] = standbyCount[s.ShiftID]
+		}
+	}
 
 	// Transform the shifts to include only user names
 	for _, shift := range shifts {
-		var userNames []string
-		for _, user := range shift.Users {
-			userNames = append(userNames, *user.FullName)
-		}
-
-		shiftsWithUserNames = append(shiftsWithUserNames, ShiftOut{
-			ID:           shift.ID,
-			Name:         shift.Name,
-			StartTime:    shift.StartTime,
-			Points:       shift.Points,
-			Description:  shift.Description,
-			Day:          shift.Day,
-			HeadCount:    shift.HeadCount,
-			CurrentCount: uint8(len(userNames)),
-			UserNames:    &userNames,
-		})
+		out := ShiftToOut(shift, viewer)
+		out.StandbyCount = standbyCount[shift.ID]
+		if position, onStandby := standbyPosition[shift.ID]; onStandby {
+			out.StandbyPosition = &position
+		}
+		shiftsWithUserNames = append(shiftsWithUserNames, out)
 	}
 
 	return shiftsWithUserNames, nil
 }
 
-// AddUserToShift adds a user to a shift
-func AddUserToShift(db *gorm.DB, shiftID, userID uint) error {
-	var shift models.Shift
-	if err := db.Preload("Users").First(&shift, shiftID).Error; err != nil {
-		return err
+// findOverlappingShift returns a shift of the user that runs at the same time as the given one
+func findOverlappingShift(db *gorm.DB, shift models.Shift, userID uint) (*models.Shift, error) {
+	if shift.StartTime == nil || shift.EndTime == nil {
+		return nil, nil
+	}
+	var overlapping []models.Shift
+	err := db.Joins("join shift_users on shifts.id = shift_users.shift_id").
+		Where("shift_users.user_id = ? AND shifts.id <> ?", userID, shift.ID).
+		Where("shifts.start_time < ? AND shifts.end_time > ?", *shift.EndTime, *shift.StartTime).
+		Order("shifts.start_time").Limit(1).Find(&overlapping).Error
+	if err != nil || len(overlapping) == 0 {
+		return nil, err
+	}
+	return &overlapping[0], nil
+}
+
+// validateShiftTimes makes sure a shift doesn't end before it starts
+func validateShiftTimes(shift models.Shift) error {
+	if shift.EndTime == nil {
+		return nil
 	}
-	if len(shift.Users) >= int(shift.HeadCount) {
-		return errors.New("this shift is already full :/")
+	if shift.StartTime == nil {
+		return errors.New("a shift with an end time also needs a start time")
 	}
+	if !shift.EndTime.After(*shift.StartTime) {
+		return errors.New("end time needs to be after the start time")
+	}
+	return nil
+}
 
-	for _, s := range shift.Users {
-		if s.ID == userID {
-			return errors.New("user is already in this shift")
+// setShiftPlace sets the category and location of a shift if they exist, 0 removes them
+func setShiftPlace(db *gorm.DB, shift *models.Shift, categoryID, locationID *uint) error {
+	if categoryID != nil && *categoryID == 0 {
+		shift.CategoryID = nil
+	} else if categoryID != nil {
+		if err := db.First(&models.ShiftCategory{}, *categoryID).Error; err != nil {
+			return fmt.Errorf("there is no category with id %d", *categoryID)
 		}
+		shift.CategoryID = categoryID
 	}
-
-	var user models.User
-	if err := db.First(&user, userID).Error; err != nil {
-		return err
+	if locationID != nil && *locationID == 0 {
+		shift.LocationID = nil
+	} else if locationID != nil {
+		if err := db.First(&models.ShiftLocation{}, *locationID).Error; err != nil {
+			return fmt.Errorf("there is no location with id %d", *locationID)
+		}
+		shift.LocationID = locationID
 	}
+	return nil
+}
+
+var (
+	ErrShiftFull      = errors.New("this shift is already full :/")
+	ErrAlreadyInShift = errors.New("user is already in this shift")
+	ErrNotInShift     = errors.New("user is not part of this shift (yet)")
+	ErrHeadCountLow   = errors.New("more users are signed up than the new head count allows")
+	ErrRosterOverlap  = errors.New("the new times overlap with other shifts of signed up users")
+)
 
-	// Add the user to the shift
-	return db.Model(&shift).Association("Users").Append(&user)
+// shiftErrorStatus is the status code for an error from adding or removing someone
+func shiftErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrShiftFull), errors.Is(err, ErrAlreadyInShift), errors.Is(err, ErrNotInShift),
+		errors.Is(err, ErrNoBuddySeats), errors.Is(err, ErrBuddyNotOpen),
+		errors.Is(err, ErrHeadCountLow), errors.Is(err, ErrRosterOverlap):
+		return http.StatusConflict
+	case errors.Is(err, ErrNotQualified), errors.Is(err, ErrSignupLimit), errors.Is(err, ErrSignupClosed),
+		errors.Is(err, ErrNotYourBuddy):
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
 }
 
-// RemoveUserFromShift removes a user from a shift
-func RemoveUserFromShift(db *gorm.DB, shiftID, userID uint) error {
+// lockShift loads the shift and locks its row until the transaction ends,
+// which serializes everything that changes who is in the shift
+func lockShift(tx *gorm.DB, shiftID uint) (models.Shift, error) {
 	var shift models.Shift
-	if err := db.Preload("Users").First(&shift, shiftID).Error; err != nil {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&shift, shiftID).Error
+	return shift, err
+}
+
+// AddUserToShift adds a user to a shift if there is a free seat. Concurrent sign-ups for the same shift
+// wait for each other, so the last seat can only be taken once.
+// Users signing up on their own need all qualifications of the shift and have to stay within the sign-up limits,
+// admins and leads may assign anyone.
+// With force, the check for overlapping shifts of the user is skipped (admins only).
+func AddUserToShift(db *gorm.DB, shiftID, userID uint, selfSignup, force bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		shift, err := lockShift(tx, shiftID)
+		if err != nil {
+			return err
+		}
+		// the users row is locked too, so the overlap check can't race with their other sign-ups
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var assigned []uint
+		if err := tx.Table("shift_users").Where("shift_id = ?", shiftID).Pluck("user_id", &assigned).Error; err != nil {
+			return err
+		}
+		if slices.Contains(assigned, userID) {
+			return ErrAlreadyInShift
+		}
+		if len(assigned) >= int(shift.HeadCount) {
+			return ErrShiftFull
+		}
+		if selfSignup {
+			if err := tx.Model(&shift).Association("Qualifications").Find(&shift.Qualifications); err != nil {
+				return err
+			}
+			if err := checkQualifications(tx, shift, userID); err != nil {
+				return err
+			}
+			if err := checkSignupLimits(tx, shift, userID); err != nil {
+				return err
+			}
+		}
+
+		if !force {
+			overlapping, err := findOverlappingShift(tx, shift, userID)
+			if err != nil {
+				return err
+			}
+			if overlapping != nil {
+				return fmt.Errorf("overlaps with shift '%s' at %s", overlapping.Name, overlapping.StartTime.Format("Mon 15:04"))
+			}
+		}
+
+		if err := tx.Create(&models.ShiftUser{ShiftID: shiftID, UserID: userID}).Error; err != nil {
+			return err
+		}
+		// no need to wait for a seat anymore
+		return tx.Where("shift_id = ? AND user_id = ?", shiftID, userID).Delete(&models.ShiftStandby{}).Error
+	})
+}
+
+// checkRosterFits makes sure the users already in the shift still fit after it was edited:
+// not more of them than the head count, and with new times no overlaps with their other shifts unless forced
+func checkRosterFits(tx *gorm.DB, shift models.Shift, timesChanged bool, force bool) error {
+	var users []models.User
+	err := tx.Joins("join shift_users on shift_users.user_id = users.id").
+		Where("shift_users.shift_id = ?", shift.ID).Order("users.id").Find(&users).Error
+	if err != nil {
 		return err
 	}
-	found := false
-	for _, s := range shift.Users {
-		if s.ID == userID {
-			found = true
-		}
+	if len(users) > int(shift.HeadCount) {
+		return fmt.Errorf("%w: %d users are already signed up, HeadCount can't be %d", ErrHeadCountLow, len(users), shift.HeadCount)
 	}
-	if !found {
-		return errors.New("user is not part of this shift (yet)")
+	if !timesChanged || force {
+		return nil
 	}
+	for _, user := range users {
+		overlapping, err := findOverlappingShift(tx, shift, user.ID)
+		if err != nil {
+			return err
+		}
+		if overlapping != nil {
+			return fmt.Errorf("%w: %s is also in shift '%s' at %s", ErrRosterOverlap, user.Nickname, overlapping.Name, overlapping.StartTime.Format("Mon 15:04"))
+		}
+	}
+	return nil
+}
 
-	var user models.User
-	if err := db.First(&user, userID).Error; err != nil {
+// RemoveUserFromShift removes a user from a shift and hands the free seat to the standby list
+// while the shift is still locked, so nobody can sign up in between
+func RemoveUserFromShift(db *gorm.DB, shiftID, userID uint) error {
+	var shift models.Shift
+	var promoted []models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := removeUserFromShift(tx, shiftID, userID); err != nil {
+			return err
+		}
+		var err error
+		shift, promoted, err = promoteStandby(tx, shiftID)
+		return err
+	})
+	if err != nil {
 		return err
 	}
+	notifyPromoted(shift, promoted)
+	return nil
+}
 
-	// Remove the user from the shift
-	return db.Model(&shift).Association("Users").Delete(&user)
+// removeUserFromShift only frees the seat, for callers that fill it themselves in the same transaction
+func removeUserFromShift(db *gorm.DB, shiftID, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockShift(tx, shiftID); err != nil {
+			return err
+		}
+		result := tx.Where("shift_id = ? AND user_id = ?", shiftID, userID).Delete(&models.ShiftUser{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotInShift
+		}
+		// open swap offers for this seat are obsolete now
+		return tx.Model(&models.ShiftSwap{}).
+			Where("shift_id = ? AND from_user_id = ? AND status = ?", shiftID, userID, models.SwapOpen).
+			Update("status", models.SwapCancelled).Error
+	})
+}
+
+type ShiftConflict struct {
+	UserID         uint       `json:"userId"`
+	Nickname       string     `json:"nickname"`
+	ShiftID        uint       `json:"shiftId"`
+	ShiftName      string     `json:"shiftName"`
+	StartTime      *time.Time `json:"startTime"`
+	EndTime        *time.Time `json:"endTime"`
+	OtherShiftID   uint       `json:"otherShiftId"`
+	OtherShiftName string     `json:"otherShiftName"`
+	OtherStartTime *time.Time `json:"otherStartTime"`
+	OtherEndTime   *time.Time `json:"otherEndTime"`
+}
+
+// GetShiftConflicts lists every pair of overlapping shifts a user is signed up for
+func GetShiftConflicts(db *gorm.DB) ([]ShiftConflict, error) {
+	conflicts := []ShiftConflict{}
+	err := db.Table("shift_users su1").
+		Select(`users.id as user_id, users.nickname,
+			s1.id as shift_id, s1.name as shift_name, s1.start_time, s1.end_time,
+			s2.id as other_shift_id, s2.name as other_shift_name, s2.start_time as other_start_time, s2.end_time as other_end_time`).
+		Joins("join shift_users su2 on su1.user_id = su2.user_id and su1.shift_id < su2.shift_id").
+		Joins("join shifts s1 on s1.id = su1.shift_id").
+		Joins("join shifts s2 on s2.id = su2.shift_id").
+		Joins("join users on users.id = su1.user_id").
+		Where("s1.start_time < s2.end_time AND s2.start_time < s1.end_time").
+		Order("users.nickname, s1.start_time").
+		Scan(&conflicts).Error
+	return conflicts, err
 }
 
 // ##########
@@ -179,20 +542,65 @@ func HandleCreateShift(db *gorm.DB) gin.HandlerFunc {
 			Description: sc.Description,
 			Day:         sc.Day,
 			StartTime:   sc.StartTime,
-			Points:      *sc.Points,
+			EndTime:     sc.EndTime,
+			TeamID:      sc.TeamID,
+			Points:      1,
+
+			RemovalDeadline: sc.RemovalDeadline,
+			ContactName:     sc.ContactName,
+			ContactPhone:    sc.ContactPhone,
+		}
+		if sc.Points != nil {
+			stc.Points = *sc.Points
+		}
+		if sc.SignupClosed != nil {
+			stc.SignupClosed = *sc.SignupClosed
+		}
+		if stc.Day != nil {
+			day, err := normalizeDay(*stc.Day)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			stc.Day = &day
+		}
+		if sc.QualificationIDs != nil {
+			qualifications, err := findQualifications(db, *sc.QualificationIDs)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			stc.Qualifications = qualifications
+		}
+		if err := setShiftPlace(db, &stc, sc.CategoryID, sc.LocationID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !canManageTeam(c, stc.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only create shifts for your own teams."})
+			return
+		}
+		if err := validateShiftTimes(stc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		fmt.Println("Desc is " + *sc.Description)
 		if err := db.Create(&stc).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Shift"})
 			return
 		}
+		stc.DescriptionHTML = util.RenderOptionalMarkdown(stc.Description)
 		c.IndentedJSON(http.StatusCreated, stc)
 	}
 }
 
 func HandleGetShifts(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		shifts, err := GetShiftsWithUserNames(db)
+		filter, err := parseShiftFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shifts, err := GetShiftsWithUserNames(db, rosterViewer(c, db), filter)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 			return
@@ -201,15 +609,30 @@ func HandleGetShifts(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+func HandleGetShiftConflicts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conflicts, err := GetShiftConflicts(db)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, conflicts)
+	}
+}
+
 func HandlePutShift(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		util.CheckUser(c)
-		uid := c.Param("id")
+		uid := c.Param("shift_id")
 		shiftExist, err := GetShiftById(db, uid)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve shift type."})
 			return
 		}
+		if !canManageTeam(c, shiftExist.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit shifts of your own teams."})
+			return
+		}
 		var su ShiftUpdate
 		if err := c.ShouldBindJSON(&su); err != nil {
 			fmt.Println(err.Error())
@@ -227,7 +650,12 @@ func HandlePutShift(db *gorm.DB) gin.HandlerFunc {
 			shiftExist.Description = su.Description
 		}
 		if su.Day != nil {
-			shiftExist.Day = su.Day
+			day, err := normalizeDay(*su.Day)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			shiftExist.Day = &day
 		}
 		if su.Points != nil {
 			shiftExist.Points = *su.Points
@@ -235,8 +663,82 @@ func HandlePutShift(db *gorm.DB) gin.HandlerFunc {
 		if su.StartTime != nil {
 			shiftExist.StartTime = su.StartTime
 		}
+		if su.EndTime != nil {
+			shiftExist.EndTime = su.EndTime
+		}
+		if su.TeamID != nil && *su.TeamID == 0 {
+			shiftExist.TeamID = nil
+		} else if su.TeamID != nil {
+			shiftExist.TeamID = su.TeamID
+		}
+		if su.RemovalDeadline != nil && su.RemovalDeadline.IsZero() {
+			shiftExist.RemovalDeadline = nil
+		} else if su.RemovalDeadline != nil {
+			shiftExist.RemovalDeadline = su.RemovalDeadline
+		}
+		if su.SignupClosed != nil {
+			shiftExist.SignupClosed = *su.SignupClosed
+		}
+		if su.QualificationIDs != nil {
+			qualifications, err := findQualifications(db, *su.QualificationIDs)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			shiftExist.Qualifications = qualifications
+		}
+		if err := setShiftPlace(db, &shiftExist, su.CategoryID, su.LocationID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if su.ContactName != nil {
+			shiftExist.ContactName = su.ContactName
+		}
+		if su.ContactPhone != nil {
+			shiftExist.ContactPhone = su.ContactPhone
+		}
+		if !canManageTeam(c, shiftExist.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only move shifts to your own teams."})
+			return
+		}
+		if err := validateShiftTimes(shiftExist); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		db.Save(&shiftExist)
+		// only admins may ignore overlapping shifts
+		_, isAdmin := c.Get("admin")
+		force := isAdmin && c.Query("force") == "true"
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// nobody can sign up while the roster is checked against the changes
+			if _, err := lockShift(tx, shiftExist.ID); err != nil {
+				return err
+			}
+			if err := checkRosterFits(tx, shiftExist, su.StartTime != nil || su.EndTime != nil, force); err != nil {
+				return err
+			}
+			if err := tx.Omit("Users").Save(&shiftExist).Error; err != nil {
+				return err
+			}
+			if su.QualificationIDs != nil {
+				return tx.Model(&shiftExist).Association("Qualifications").Replace(shiftExist.Qualifications)
+			}
+			return nil
+		})
+		if errors.Is(err, ErrHeadCountLow) || errors.Is(err, ErrRosterOverlap) {
+			c.JSON(shiftErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save shift"})
+			return
+		}
+		// a higher head count makes room for people on the standby list
+		if err := FillFromStandby(db, shiftExist.ID); err != nil {
+			fmt.Println("Failed to promote standby users:", err.Error())
+		}
+		shiftExist.DescriptionHTML = util.RenderOptionalMarkdown(shiftExist.Description)
 		c.JSON(http.StatusOK, shiftExist)
 
 	}
@@ -248,14 +750,29 @@ func HandleAddUserToShift(db *gorm.DB) gin.HandlerFunc {
 		sid := c.Param("shift_id")
 		shiftIDUint, _ := strconv.ParseUint(sid, 10, 32)
 		userIDUint, _ := strconv.ParseUint(uid, 10, 32)
+		// only admins may ignore overlapping shifts
+		_, isAdmin := c.Get("admin")
+		force := isAdmin && c.Query("force") == "true"
 
-		if err := AddUserToShift(db, uint(shiftIDUint), uint(userIDUint)); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		shiftExist, err := GetShiftById(db, sid)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		if !canManageTeam(c, shiftExist.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only staff shifts of your own teams."})
 			return
 		}
-		shiftExist, _ := GetShiftById(db, sid)
 
-		c.JSON(http.StatusOK, ShiftToOut(shiftExist))
+		if err := AddUserToShift(db, uint(shiftIDUint), uint(userIDUint), false, force); err != nil {
+			c.JSON(shiftErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		shiftExist, _ = GetShiftById(db, sid)
+
+		out := ShiftToOut(shiftExist, rosterViewer(c, db))
+		out.Warnings = assignmentWarnings(db, shiftExist, uint(userIDUint))
+		c.JSON(http.StatusOK, out)
 	}
 }
 
@@ -271,13 +788,23 @@ func HandleAddMeToShift(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := AddUserToShift(db, uint(shiftIDUint), userId2); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		shiftExist, err := GetShiftById(db, sid)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		if shiftExist.SelfSignupClosed() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the roster for this shift is final, please ask an admin"})
 			return
 		}
 
-		shiftExist, _ := GetShiftById(db, sid)
-		c.JSON(http.StatusOK, ShiftToOut(shiftExist))
+		if err := AddUserToShift(db, uint(shiftIDUint), userId2, true, false); err != nil {
+			c.JSON(shiftErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		shiftExist, _ = GetShiftById(db, sid)
+		c.JSON(http.StatusOK, ShiftToOut(shiftExist, rosterViewer(c, db)))
 	}
 }
 
@@ -288,13 +815,23 @@ func HandleRemoveUserFromShift(db *gorm.DB) gin.HandlerFunc {
 		shiftIDUint, _ := strconv.ParseUint(sid, 10, 32)
 		userIDUint, _ := strconv.ParseUint(uid, 10, 32)
 
+		shiftExist, err := GetShiftById(db, sid)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		if !canManageTeam(c, shiftExist.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only staff shifts of your own teams."})
+			return
+		}
+
 		if err := RemoveUserFromShift(db, uint(shiftIDUint), uint(userIDUint)); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(shiftErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		shiftExist, _ := GetShiftById(db, sid)
+		shiftExist, _ = GetShiftById(db, sid)
 
-		c.JSON(http.StatusOK, ShiftToOut(shiftExist))
+		c.JSON(http.StatusOK, ShiftToOut(shiftExist, rosterViewer(c, db)))
 	}
 }
 
@@ -311,14 +848,25 @@ func HandleRemoveMeFromShift(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		shiftExist, err := GetShiftById(db, sid)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		// after the deadline the only way out is a swap with someone else
+		if deadline := shiftExist.SelfRemovalDeadline(); deadline != nil && time.Now().After(*deadline) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "it is too late to leave this shift, please offer a swap instead"})
+			return
+		}
+
 		if err := RemoveUserFromShift(db, uint(shiftIDUint), userId2); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(shiftErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
-		shiftExist, _ := GetShiftById(db, sid)
+		shiftExist, _ = GetShiftById(db, sid)
 
-		c.JSON(http.StatusOK, ShiftToOut(shiftExist))
+		c.JSON(http.StatusOK, ShiftToOut(shiftExist, rosterViewer(c, db)))
 	}
 }
 
@@ -330,22 +878,46 @@ func HandleDeleteshift(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve shift type."})
 			return
 		}
-		db.Delete(&shiftExist)
+		if !canManageTeam(c, shiftExist.TeamID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete shifts of your own teams."})
+			return
+		}
+		if err := DeleteShift(db, shiftExist); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shift"})
+			return
+		}
 		c.JSON(http.StatusOK, shiftExist)
 	}
 }
 
+// DeleteShift deletes the shift together with its standby list and buddy requests
+func DeleteShift(db *gorm.DB, shift models.Shift) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("shift_id = ?", shift.ID).Delete(&models.ShiftStandby{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("shift_id = ?", shift.ID).Delete(&models.ShiftBuddy{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&shift).Error
+	})
+}
+
 // Ingest CSV for shifts
 
-// ValidateDayValue checks if the day value is one of the allowed values
-func validateDayValue(day string) bool {
-	validDays := []string{"Montag", "Freitag", "Samstag", "Sonntag"}
-	for _, validDay := range validDays {
-		if day == validDay {
-			return true
-		}
+// normalizeDay checks that the day is one of the configured event days (by name or date) and returns its name
+func normalizeDay(day string) (string, error) {
+	eventDay, ok := models.FindEventDay(day)
+	if !ok {
+		return "", fmt.Errorf("invalid Day value: %s. Must be one of [%s]", day, strings.Join(models.EventDayNames(), ", "))
+	}
+	return eventDay.Name, nil
+}
+
+func GetEventDays(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.IndentedJSON(http.StatusOK, models.EventDays())
 	}
-	return false
 }
 
 // ImportShiftsFromCSV handles CSV file upload and imports data to shifts table
@@ -402,52 +974,143 @@ func ImportShiftsFromCSV(db *gorm.DB) gin.HandlerFunc {
 			}
 		}
 
-		// Process data rows
-		shifts := []models.Shift{}
-		errors := []string{}
+		result, shifts := planShiftImport(db, records, headers)
+		result.DryRun = c.Query("dryRun") == "true"
+
+		if c.Query("strict") == "true" && result.Failed > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Some rows could not be processed",
+				"result": result,
+			})
+			return
+		}
+		if result.DryRun {
+			result.Message = fmt.Sprintf("Probelauf: %d Schichten würden importiert, %d aktualisiert. Bei %d Zeilen gab es Probleme", result.Created, result.Updated, result.Failed)
+			c.JSON(http.StatusOK, result)
+			return
+		}
+
+		// Save to database using a transaction
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, shift := range shifts {
+				if shift.ID == 0 {
+					if err := tx.Create(&shift).Error; err != nil {
+						return err
+					}
+				} else if err := tx.Omit("Users").Save(&shift).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to save shifts to database",
+			})
+			return
+		}
+
+		result.Message = fmt.Sprintf("%d Schichten wurden importiert, %d aktualisiert. Bei %d Zeilen gab es Probleme", result.Created, result.Updated, result.Failed)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// planShiftImport validates all rows and decides for each one whether it creates a new shift or
+// updates the one with the same key. Nothing is written to the DB.
+func planShiftImport(db *gorm.DB, records [][]string, headers map[string]int) (ShiftImportResult, []models.Shift) {
+	result := ShiftImportResult{Rows: []ShiftImportRow{}}
+	shifts := []models.Shift{}
+	seenKeys := map[string]int{}
+
+	for i, record := range records[1:] {
+		rowNum := i + 2 // +1 for 0-index, +1 for header row
+
+		// Skip empty rows
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+
+		row := ShiftImportRow{Row: rowNum, Action: ImportCreate}
+		fail := func(err error) {
+			msg := err.Error()
+			row.Action = ImportError
+			row.Error = &msg
+			result.Failed++
+			result.Rows = append(result.Rows, row)
+		}
 
-		for i, record := range records[1:] {
-			rowNum := i + 2 // +1 for 0-index, +1 for header row
+		shift, err := processShiftRow(record, headers)
+		row.Name = shift.Name
+		row.Key = shift.ExternalKey
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if err := validateShiftTimes(shift); err != nil {
+			fail(err)
+			continue
+		}
 
-			// Skip empty rows
-			if len(record) == 0 {
+		if shift.ExternalKey != nil {
+			key := *shift.ExternalKey
+			if firstRow, seen := seenKeys[key]; seen {
+				fail(fmt.Errorf("key %s was already used in row %d", key, firstRow))
 				continue
 			}
+			seenKeys[key] = rowNum
 
-			shift, err := processShiftRow(record, headers)
+			existing, err := findShiftByKey(db, key)
 			if err != nil {
-				errors = append(errors, fmt.Sprintf("Row %d: %s", rowNum, err.Error()))
+				fail(err)
 				continue
 			}
-
-			shifts = append(shifts, shift)
+			if existing != nil {
+				if len(existing.Users) > int(shift.HeadCount) {
+					fail(fmt.Errorf("%d users are already signed up, HeadCount can't be %d", len(existing.Users), shift.HeadCount))
+					continue
+				}
+				existing.Name = shift.Name
+				existing.HeadCount = shift.HeadCount
+				existing.Points = shift.Points
+				existing.Description = shift.Description
+				existing.Day = shift.Day
+				existing.StartTime = shift.StartTime
+				existing.EndTime = shift.EndTime
+				shift = *existing
+				row.Action = ImportUpdate
+			}
 		}
 
-		// if len(errors) > 0 {
-		// 	c.JSON(http.StatusBadRequest, gin.H{
-		// 		"error":  "Some rows could not be processed",
-		// 		"errors": errors,
-		// 	})
-		// 	return
-		// }
-
-		// Save to database using a transaction
-		tx := db.Begin()
-		for _, shift := range shifts {
-			if err := tx.Create(&shift).Error; err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": "Failed to save shifts to database",
-				})
-				return
-			}
+		if row.Action == ImportUpdate {
+			result.Updated++
+		} else {
+			result.Created++
 		}
-		tx.Commit()
+		result.Rows = append(result.Rows, row)
+		shifts = append(shifts, shift)
+	}
+	return result, shifts
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": fmt.Sprintf("%d Schichten wurden importiert. Bei %d Zeilen gab es Probleme", len(shifts), len(errors)),
-		})
+// findShiftByKey looks up a shift by its external key. Exported shifts without one use "#<id>" as key.
+func findShiftByKey(db *gorm.DB, key string) (*models.Shift, error) {
+	var shifts []models.Shift
+	query := db.Preload("Users")
+	if id, isID := strings.CutPrefix(key, "#"); isID {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("external_key = ?", key)
+	}
+	if err := query.Limit(1).Find(&shifts).Error; err != nil {
+		return nil, err
+	}
+	if len(shifts) == 0 {
+		if strings.HasPrefix(key, "#") {
+			return nil, fmt.Errorf("there is no shift with id %s", strings.TrimPrefix(key, "#"))
+		}
+		return nil, nil
 	}
+	return &shifts[0], nil
 }
 
 // processShiftRow processes a single row from the CSV
@@ -464,6 +1127,12 @@ func processShiftRow(record []string, headers map[string]int) (models.Shift, err
 		return shift, fmt.Errorf("name cannot be empty")
 	}
 
+	// Process Key (optional)
+	if keyIdx, exists := headers["key"]; exists && keyIdx < len(record) && strings.TrimSpace(record[keyIdx]) != "" {
+		key := strings.TrimSpace(record[keyIdx])
+		shift.ExternalKey = &key
+	}
+
 	// Process HeadCount (required)
 	headCountIdx, exists := headers["headcount"]
 	if !exists || headCountIdx >= len(record) {
@@ -494,12 +1163,14 @@ func processShiftRow(record []string, headers map[string]int) (models.Shift, err
 	}
 
 	// Process Day (optional)
+	var eventDay *models.EventDay
 	if dayIdx, exists := headers["day"]; exists && dayIdx < len(record) && record[dayIdx] != "" {
-		day := strings.TrimSpace(record[dayIdx])
-		if !validateDayValue(day) {
-			return shift, fmt.Errorf("invalid Day value: %s. Must be one of [Montag, Freitag, Samstag, Sonntag]", day)
+		day, ok := models.FindEventDay(strings.TrimSpace(record[dayIdx]))
+		if !ok {
+			return shift, fmt.Errorf("invalid Day value: %s. Must be one of [%s]", record[dayIdx], strings.Join(models.EventDayNames(), ", "))
 		}
-		shift.Day = &day
+		shift.Day = &day.Name
+		eventDay = &day
 	}
 
 	// Process StartTime (optional)
@@ -512,12 +1183,35 @@ func processShiftRow(record []string, headers map[string]int) (models.Shift, err
 			return shift, fmt.Errorf("invalid StartTime format: %s. Expected HH:mm", timeStr)
 		}
 
-		// Use current date for the time value to create a full timestamp
-		now := time.Now()
-		loc, _ := time.LoadLocation("Europe/Berlin")
-		fullTime := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+		// The time is on the date of the event day
+		if eventDay == nil {
+			return shift, fmt.Errorf("StartTime %s given without a Day", timeStr)
+		}
+		date := eventDay.Date
+		fullTime := time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, models.EventLocation())
 		shift.StartTime = &fullTime
 	}
 
+	// Process EndTime (optional, needs a StartTime)
+	if timeIdx, exists := headers["endtime"]; exists && timeIdx < len(record) && record[timeIdx] != "" {
+		timeStr := strings.TrimSpace(record[timeIdx])
+		if shift.StartTime == nil {
+			return shift, fmt.Errorf("EndTime %s given without a StartTime", timeStr)
+		}
+
+		t, err := time.Parse("15:04", timeStr)
+		if err != nil {
+			return shift, fmt.Errorf("invalid EndTime format: %s. Expected HH:mm", timeStr)
+		}
+
+		start := *shift.StartTime
+		endTime := time.Date(start.Year(), start.Month(), start.Day(), t.Hour(), t.Minute(), 0, 0, start.Location())
+		// shifts going past midnight end on the next day
+		if !endTime.After(start) {
+			endTime = endTime.AddDate(0, 0, 1)
+		}
+		shift.EndTime = &endTime
+	}
+
 	return shift, nil
 }
@@ -11,17 +11,19 @@ import (
 )
 
 type SpotUpdate struct {
-	Name        *string `json:"name"`
-	Price       *uint16 `json:"price"`
-	Limit       *uint16 `json:"limit"`
-	Description *string `json:"description"`
+	Name           *string `json:"name"`
+	Price          *uint16 `json:"price"`
+	Limit          *uint16 `json:"limit"`
+	Description    *string `json:"description"`
+	RequiredPoints *uint8  `json:"requiredPoints"`
 }
 
 type SpotCreate struct {
-	Name        string  `json:"name"`
-	Price       uint16  `json:"price"`
-	Limit       uint16  `json:"limit"`
-	Description *string `json:"description"`
+	Name           string  `json:"name"`
+	Price          uint16  `json:"price"`
+	Limit          uint16  `json:"limit"`
+	Description    *string `json:"description"`
+	RequiredPoints uint8   `json:"requiredPoints"`
 }
 
 func GetSpotById(db *gorm.DB, id string) (models.SpotType, error) {
@@ -47,6 +49,9 @@ func GetSpots(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not retrive Spots."})
 			return
 		}
+		for i := range spotTypes {
+			spotTypes[i].DescriptionHTML = util.RenderOptionalMarkdown(spotTypes[i].Description)
+		}
 		c.IndentedJSON(http.StatusOK, spotTypes)
 	}
 }
@@ -61,15 +66,17 @@ func CreateSpot(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		stc := models.SpotType{
-			Name:        sc.Name,
-			Limit:       sc.Limit,
-			Price:       sc.Price,
-			Description: sc.Description,
+			Name:           sc.Name,
+			Limit:          sc.Limit,
+			Price:          sc.Price,
+			Description:    sc.Description,
+			RequiredPoints: sc.RequiredPoints,
 		}
 		if err := db.Create(&stc).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create spottype"})
 			return
 		}
+		stc.DescriptionHTML = util.RenderOptionalMarkdown(stc.Description)
 		c.IndentedJSON(http.StatusCreated, stc)
 	}
 }
@@ -101,8 +108,12 @@ func PutSpot(db *gorm.DB) gin.HandlerFunc {
 		if su.Price != nil {
 			spotExist.Price = *su.Price
 		}
+		if su.RequiredPoints != nil {
+			spotExist.RequiredPoints = *su.RequiredPoints
+		}
 
 		db.Save(&spotExist)
+		spotExist.DescriptionHTML = util.RenderOptionalMarkdown(spotExist.Description)
 		c.JSON(http.StatusOK, spotExist)
 
 	}
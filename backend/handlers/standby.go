@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+// JoinStandby puts the user on the standby list of a full shift
+func JoinStandby(db *gorm.DB, shiftID, userID uint) error {
+	var shift models.Shift
+	if err := db.Preload("Users").Preload("Qualifications").First(&shift, shiftID).Error; err != nil {
+		return err
+	}
+	for _, u := range shift.Users {
+		if u.ID == userID {
+			return errors.New("user is already in this shift")
+		}
+	}
+	if len(shift.Users) < int(shift.HeadCount) {
+		return errors.New("this shift still has free seats, just sign up")
+	}
+	// waiting is pointless if the user could never be promoted
+	if err := checkQualifications(db, shift, userID); err != nil {
+		return err
+	}
+	var count int64
+	if err := db.Model(&models.ShiftStandby{}).Where("shift_id = ? AND user_id = ?", shiftID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("user is already on the standby list")
+	}
+	return db.Create(&models.ShiftStandby{ShiftID: shiftID, UserID: userID}).Error
+}
+
+// promoteStandby fills the free seats of a shift with the users on its standby list, in order.
+// Users that can't take the shift anymore (e.g. overlapping shifts) stay on the list.
+// It has to run in the transaction that holds the lock on the shift, the promoted users
+// are only told with notifyPromoted once it is committed.
+func promoteStandby(db *gorm.DB, shiftID uint) (models.Shift, []models.User, error) {
+	promoted := []models.User{}
+	var shift models.Shift
+	if err := db.Preload("Users").First(&shift, shiftID).Error; err != nil {
+		return shift, promoted, err
+	}
+	free := int(shift.HeadCount) - len(shift.Users)
+	if free <= 0 {
+		return shift, promoted, nil
+	}
+	var standbys []models.ShiftStandby
+	if err := db.Where("shift_id = ?", shiftID).Order("created_at, id").Find(&standbys).Error; err != nil {
+		return shift, promoted, err
+	}
+	for _, standby := range standbys {
+		if len(promoted) == free {
+			break
+		}
+		if err := AddUserToShift(db, shiftID, standby.UserID, true, false); err != nil {
+			continue
+		}
+		var user models.User
+		if err := db.First(&user, standby.UserID).Error; err != nil {
+			return shift, promoted, err
+		}
+		promoted = append(promoted, user)
+	}
+	return shift, promoted, nil
+}
+
+// notifyPromoted lets the users know that they moved up from the standby list
+func notifyPromoted(shift models.Shift, promoted []models.User) {
+	for _, user := range promoted {
+		notifyUsers([]models.User{user}, "Du bist nachgerückt: "+shift.Name,
+			fmt.Sprintf("in der Schicht %s ist ein Platz frei geworden und du bist von der Warteliste nachgerückt.", shiftLabel(shift)))
+	}
+}
+
+// FillFromStandby gives the free seats of a shift to its standby list, e.g. after the head count was raised
+func FillFromStandby(db *gorm.DB, shiftID uint) error {
+	var shift models.Shift
+	var promoted []models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockShift(tx, shiftID); err != nil {
+			return err
+		}
+		var err error
+		shift, promoted, err = promoteStandby(tx, shiftID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	notifyPromoted(shift, promoted)
+	return nil
+}
+
+// ##########
+// Handlers
+// ##########
+
+func HandleJoinStandby(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sid := c.Param("shift_id")
+		shiftIDUint, _ := strconv.ParseUint(sid, 10, 32)
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		if err := JoinStandby(db, uint(shiftIDUint), userId.(uint)); err != nil {
+			c.JSON(shiftErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		shiftExist, err := GetShiftById(db, sid)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		var standbys []models.ShiftStandby
+		if err := db.Where("shift_id = ?", shiftExist.ID).Order("created_at, id").Find(&standbys).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		out := ShiftToOut(shiftExist, rosterViewer(c, db))
+		out.StandbyCount = len(standbys)
+		for i, standby := range standbys {
+			if standby.UserID == userId.(uint) {
+				position := i + 1
+				out.StandbyPosition = &position
+			}
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+func HandleLeaveStandby(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sid := c.Param("shift_id")
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		result := db.Where("shift_id = ? AND user_id = ?", sid, userId).Delete(&models.ShiftStandby{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave the standby list"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user is not on the standby list"})
+			return
+		}
+		c.JSON(http.StatusOK, "ok")
+	}
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+// LeaderboardEntry is a user on the leaderboard, only with what they chose to show
+type LeaderboardEntry struct {
+	Rank         int     `json:"rank"`
+	Nickname     string  `json:"nickname"`
+	AvatarUrlSm  *string `json:"avatarUrlSm"`
+	EarnedPoints uint16  `json:"earnedPoints"`
+	// completed shifts starting between 22:00 and 6:00
+	NightShifts int `json:"nightShifts"`
+}
+
+type TeamStats struct {
+	TeamID *uint  `json:"teamId"`
+	Name   string `json:"name"`
+	Shifts int    `json:"shifts"`
+	// person hours the shifts need and the ones people signed up for
+	HoursNeeded  float64 `json:"hoursNeeded"`
+	HoursCovered float64 `json:"hoursCovered"`
+}
+
+type DayStats struct {
+	Day          string `json:"day"`
+	Shifts       int    `json:"shifts"`
+	FilledShifts int    `json:"filledShifts"`
+	// share of the shifts of the day that have all their seats taken
+	FilledFraction float64 `json:"filledFraction"`
+	Seats          int     `json:"seats"`
+	FilledSeats    int     `json:"filledSeats"`
+}
+
+type CrewStats struct {
+	Teams []TeamStats `json:"teams"`
+	Days  []DayStats  `json:"days"`
+}
+
+// GetLeaderboard ranks the users who opted in by their earned points, users with the same points share a rank
+func GetLeaderboard(db *gorm.DB) ([]LeaderboardEntry, error) {
+	entries := []LeaderboardEntry{}
+	var users []models.User
+	if err := withShiftPoints(db).Where("on_leaderboard").Order("earned_points desc").Order("nickname asc").Find(&users).Error; err != nil {
+		return entries, err
+	}
+	var shiftUsers []models.ShiftUser
+	if err := db.Where("attendance = ?", models.AttendanceCompleted).Find(&shiftUsers).Error; err != nil {
+		return entries, err
+	}
+	var shifts []models.Shift
+	if err := db.Where("start_time IS NOT NULL").Find(&shifts).Error; err != nil {
+		return entries, err
+	}
+	nightShifts := map[uint]bool{}
+	for _, shift := range shifts {
+		if isNightShift(shift) {
+			nightShifts[shift.ID] = true
+		}
+	}
+	nights := map[uint]int{}
+	for _, su := range shiftUsers {
+		if nightShifts[su.ShiftID] {
+			nights[su.UserID]++
+		}
+	}
+
+	for i, user := range users {
+		entry := LeaderboardEntry{
+			Rank:        i + 1,
+			Nickname:    user.Nickname,
+			AvatarUrlSm: user.AvatarUrlSm,
+			NightShifts: nights[user.ID],
+		}
+		if user.EarnedPoints != nil {
+			entry.EarnedPoints = *user.EarnedPoints
+		}
+		if i > 0 && entries[i-1].EarnedPoints == entry.EarnedPoints {
+			entry.Rank = entries[i-1].Rank
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// statsDay is the event day of a shift by name, or its date if it has no day
+func statsDay(shift models.Shift) string {
+	if shift.Day != nil {
+		return *shift.Day
+	}
+	if shift.StartTime == nil {
+		return ""
+	}
+	date := shift.StartTime.In(models.EventLocation()).Format("2006-01-02")
+	if day, ok := models.FindEventDay(date); ok {
+		return day.Name
+	}
+	return date
+}
+
+// GetCrewStats sums up the shifts per team and per day
+func GetCrewStats(db *gorm.DB) (CrewStats, error) {
+	stats := CrewStats{Teams: []TeamStats{}, Days: []DayStats{}}
+	var shifts []models.Shift
+	if err := db.Preload("Users").Find(&shifts).Error; err != nil {
+		return stats, err
+	}
+	var teams []models.Team
+	if err := db.Order("name asc").Find(&teams).Error; err != nil {
+		return stats, err
+	}
+
+	byTeam := map[uint]*TeamStats{}
+	for _, team := range teams {
+		stats.Teams = append(stats.Teams, TeamStats{TeamID: &team.ID, Name: team.Name})
+	}
+	// shifts without a team come last
+	stats.Teams = append(stats.Teams, TeamStats{Name: "Ohne Team"})
+	for i := range stats.Teams {
+		if stats.Teams[i].TeamID != nil {
+			byTeam[*stats.Teams[i].TeamID] = &stats.Teams[i]
+		}
+	}
+	noTeam := &stats.Teams[len(stats.Teams)-1]
+
+	byDay := map[string]*DayStats{}
+	for _, shift := range shifts {
+		team := noTeam
+		if shift.TeamID != nil && byTeam[*shift.TeamID] != nil {
+			team = byTeam[*shift.TeamID]
+		}
+		team.Shifts++
+		if shift.StartTime != nil && shift.EndTime != nil {
+			hours := shift.EndTime.Sub(*shift.StartTime).Hours()
+			team.HoursNeeded += hours * float64(shift.HeadCount)
+			team.HoursCovered += hours * float64(min(len(shift.Users), int(shift.HeadCount)))
+		}
+
+		dayName := statsDay(shift)
+		if dayName == "" {
+			continue
+		}
+		day, exists := byDay[dayName]
+		if !exists {
+			day = &DayStats{Day: dayName}
+			byDay[dayName] = day
+		}
+		day.Shifts++
+		day.Seats += int(shift.HeadCount)
+		day.FilledSeats += min(len(shift.Users), int(shift.HeadCount))
+		if len(shift.Users) >= int(shift.HeadCount) {
+			day.FilledShifts++
+		}
+	}
+	if noTeam.Shifts == 0 {
+		stats.Teams = stats.Teams[:len(stats.Teams)-1]
+	}
+
+	// the configured event days in their order, other dates after them
+	for _, eventDay := range models.EventDays() {
+		if day, exists := byDay[eventDay.Name]; exists {
+			stats.Days = append(stats.Days, *day)
+			delete(byDay, eventDay.Name)
+		}
+	}
+	others := []DayStats{}
+	for _, day := range byDay {
+		others = append(others, *day)
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Day < others[j].Day })
+	stats.Days = append(stats.Days, others...)
+	for i := range stats.Days {
+		if stats.Days[i].Shifts > 0 {
+			stats.Days[i].FilledFraction = float64(stats.Days[i].FilledShifts) / float64(stats.Days[i].Shifts)
+		}
+	}
+	return stats, nil
+}
+
+// ##########
+// Handlers
+// ##########
+
+func HandleGetLeaderboard(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entries, err := GetLeaderboard(db)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, entries)
+	}
+}
+
+func HandleGetCrewStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := GetCrewStats(db)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"sfpr/models"
+)
+
+type SwapCreate struct {
+	ToUserID *uint `json:"toUserId"`
+}
+
+type SwapOut struct {
+	ID        uint             `json:"id"`
+	Shift     ShiftOut         `json:"shift"`
+	FromUser  ShiftParticipant `json:"fromUser"`
+	ToUserID  *uint            `json:"toUserId"`
+	Status    string           `json:"status"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+func SwapToOut(swap models.ShiftSwap, viewer RosterViewer) SwapOut {
+	out := SwapOut{
+		ID:        swap.ID,
+		ToUserID:  swap.ToUserID,
+		Status:    swap.Status,
+		CreatedAt: swap.CreatedAt,
+	}
+	shift := models.Shift{}
+	if swap.Shift != nil {
+		shift = *swap.Shift
+		out.Shift = ShiftToOut(shift, viewer)
+	}
+	if swap.FromUser != nil {
+		out.FromUser = viewer.participant(shift, swap.FromUser)
+	}
+	return out
+}
+
+// shiftLabel is a short human readable description of a shift, e.g. for mails
+func shiftLabel(shift models.Shift) string {
+	label := shift.Name
+	if shift.Day != nil {
+		label += " am " + *shift.Day
+	}
+	if shift.StartTime != nil {
+		label += " um " + shift.StartTime.Format("15:04")
+	}
+	return label
+}
+
+// AcceptSwap hands the seat of the offering user over to the accepting user in one transaction
+func AcceptSwap(db *gorm.DB, swapID uint, userID uint) (models.ShiftSwap, error) {
+	var swap models.ShiftSwap
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// two people accepting at once must not both get the seat
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&swap, swapID).Error; err != nil {
+			return err
+		}
+		if swap.Status != models.SwapOpen {
+			return errors.New("this swap is not open anymore")
+		}
+		if swap.FromUserID == userID {
+			return errors.New("you cannot accept your own swap")
+		}
+		if swap.ToUserID != nil && *swap.ToUserID != userID {
+			return errors.New("this swap is meant for someone else")
+		}
+
+		// the seat goes to the accepting user, not to the standby list
+		if err := removeUserFromShift(tx, swap.ShiftID, swap.FromUserID); err != nil {
+			return err
+		}
+		if err := AddUserToShift(tx, swap.ShiftID, userID, true, false); err != nil {
+			return err
+		}
+
+		swap.Status = models.SwapAccepted
+		swap.AcceptedByID = &userID
+		return tx.Save(&swap).Error
+	})
+	return swap, err
+}
+
+// ##########
+// Handlers
+// ##########
+
+// HandleCreateSwap offers the current users seat in a shift to someone else
+func HandleCreateSwap(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sid := c.Param("shift_id")
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		me := userId.(uint)
+
+		// an empty body offers the shift to everyone
+		var sc SwapCreate
+		if err := c.ShouldBindJSON(&sc); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		shiftExist, err := GetShiftById(db, sid)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve shift."})
+			return
+		}
+		found := false
+		for _, u := range shiftExist.Users {
+			if u.ID == me {
+				found = true
+			}
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user is not part of this shift (yet)"})
+			return
+		}
+
+		var openSwaps int64
+		db.Model(&models.ShiftSwap{}).Where("shift_id = ? AND from_user_id = ? AND status = ?", shiftExist.ID, me, models.SwapOpen).Count(&openSwaps)
+		if openSwaps > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "you already offered this shift"})
+			return
+		}
+
+		var toUser models.User
+		if sc.ToUserID != nil {
+			if *sc.ToUserID == me {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot swap with yourself"})
+				return
+			}
+			if err := db.First(&toUser, *sc.ToUserID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve user."})
+				return
+			}
+		}
+
+		swap := models.ShiftSwap{
+			ShiftID:    shiftExist.ID,
+			FromUserID: me,
+			ToUserID:   sc.ToUserID,
+			Status:     models.SwapOpen,
+		}
+		if err := db.Create(&swap).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create swap"})
+			return
+		}
+		if err := db.Preload("Shift.Users").Preload("FromUser").First(&swap, swap.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load swap"})
+			return
+		}
+
+		if sc.ToUserID != nil {
+			notifyUsers([]models.User{toUser}, "Schicht-Tausch Anfrage",
+				fmt.Sprintf("%s möchte dir die Schicht %s übergeben. Du kannst den Tausch auf der Schichtseite annehmen.", swap.FromUser.Nickname, shiftLabel(*swap.Shift)))
+		}
+		c.IndentedJSON(http.StatusCreated, SwapToOut(swap, rosterViewer(c, db)))
+	}
+}
+
+// HandleGetSwaps lists the open swaps the current user can accept as well as their own open offers
+func HandleGetSwaps(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		var swaps []models.ShiftSwap
+		query := db.Preload("Shift.Users").Preload("FromUser").
+			Where("status = ?", models.SwapOpen).
+			Where("to_user_id IS NULL OR to_user_id = ? OR from_user_id = ?", userId, userId)
+		if err := query.Order("created_at asc").Find(&swaps).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		viewer := rosterViewer(c, db)
+		swapsOut := make([]SwapOut, len(swaps))
+		for i, swap := range swaps {
+			swapsOut[i] = SwapToOut(swap, viewer)
+		}
+		c.IndentedJSON(http.StatusOK, swapsOut)
+	}
+}
+
+func HandleAcceptSwap(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		swapIDUint, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+
+		swap, err := AcceptSwap(db, uint(swapIDUint), userId.(uint))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Preload("Shift.Users").Preload("FromUser").First(&swap, swap.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load swap"})
+			return
+		}
+
+		var acceptedBy models.User
+		db.First(&acceptedBy, userId)
+		label := shiftLabel(*swap.Shift)
+		notifyUsers([]models.User{*swap.FromUser}, "Schicht getauscht",
+			fmt.Sprintf("%s hat deine Schicht %s übernommen. Du bist jetzt nicht mehr eingetragen.", acceptedBy.Nickname, label))
+		notifyUsers([]models.User{acceptedBy}, "Schicht getauscht",
+			fmt.Sprintf("Du hast die Schicht %s von %s übernommen. Danke!", label, swap.FromUser.Nickname))
+
+		c.JSON(http.StatusOK, SwapToOut(swap, rosterViewer(c, db)))
+	}
+}
+
+// HandleCancelSwap withdraws an open swap offer of the current user
+func HandleCancelSwap(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+			return
+		}
+		var swap models.ShiftSwap
+		if err := db.First(&swap, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve swap."})
+			return
+		}
+		if swap.FromUserID != userId.(uint) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "this is not your swap"})
+			return
+		}
+		if swap.Status != models.SwapOpen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "this swap is not open anymore"})
+			return
+		}
+		swap.Status = models.SwapCancelled
+		db.Save(&swap)
+		c.JSON(http.StatusOK, swap)
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+)
+
+type TeamUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+type TeamCreate struct {
+	Name        string  `json:"name" binding:"required"`
+	Description *string `json:"description"`
+}
+
+type TeamOut struct {
+	ID          uint                       `json:"id"`
+	Name        string                     `json:"name"`
+	Description *string                    `json:"description"`
+	Leads       []models.UserShortResponse `json:"leads"`
+}
+
+func TeamToOut(team models.Team) TeamOut {
+	leads := make([]models.UserShortResponse, len(team.Leads))
+	for i, lead := range team.Leads {
+		leads[i] = lead.ToShortResponse()
+	}
+	return TeamOut{
+		ID:          team.ID,
+		Name:        team.Name,
+		Description: team.Description,
+		Leads:       leads,
+	}
+}
+
+func GetTeamById(db *gorm.DB, id string) (models.Team, error) {
+	var teamExist models.Team
+	if err := db.Preload("Leads").First(&teamExist, "id = ?", id).Error; err != nil {
+		return teamExist, err
+	}
+	return teamExist, nil
+}
+
+// canManageTeam is true for admins and for leads of the given team.
+// Shifts without a team can only be managed by admins.
+func canManageTeam(c *gin.Context, teamID *uint) bool {
+	if _, isAdmin := c.Get("admin"); isAdmin {
+		return true
+	}
+	if teamID == nil {
+		return false
+	}
+	teamIDs, exists := c.Get("team_ids")
+	if !exists {
+		return false
+	}
+	for _, id := range teamIDs.([]uint) {
+		if id == *teamID {
+			return true
+		}
+	}
+	return false
+}
+
+// ##########
+// Handlers
+// ##########
+
+// GetTeams returns all teams for admins and only the own teams for team leads
+func GetTeams(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var teams []models.Team
+		query := db.Preload("Leads").Order("name asc")
+		if _, isAdmin := c.Get("admin"); !isAdmin {
+			teamIDs, _ := c.Get("team_ids")
+			query = query.Where("id IN ?", teamIDs)
+		}
+		if err := query.Find(&teams).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		teamsOut := make([]TeamOut, len(teams))
+		for i, team := range teams {
+			teamsOut[i] = TeamToOut(team)
+		}
+		c.IndentedJSON(http.StatusOK, teamsOut)
+	}
+}
+
+func CreateTeam(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var tc TeamCreate
+		if err := c.ShouldBindJSON(&tc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		team := models.Team{
+			Name:        tc.Name,
+			Description: tc.Description,
+		}
+		if err := db.Create(&team).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create team"})
+			return
+		}
+		c.IndentedJSON(http.StatusCreated, TeamToOut(team))
+	}
+}
+
+func PutTeam(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamExist, err := GetTeamById(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve team."})
+			return
+		}
+		var tu TeamUpdate
+		if err := c.ShouldBindJSON(&tu); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if tu.Name != nil {
+			teamExist.Name = *tu.Name
+		}
+		if tu.Description != nil {
+			teamExist.Description = tu.Description
+		}
+		if err := db.Omit("Leads").Save(&teamExist).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save team"})
+			return
+		}
+		c.JSON(http.StatusOK, TeamToOut(teamExist))
+	}
+}
+
+// DeleteTeam removes the team, its shifts stay but don't belong to a team anymore
+func DeleteTeam(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamExist, err := GetTeamById(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve team."})
+			return
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Shift{}).Where("team_id = ?", teamExist.ID).Update("team_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&teamExist).Association("Leads").Clear(); err != nil {
+				return err
+			}
+			return tx.Delete(&teamExist).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
+			return
+		}
+		c.JSON(http.StatusOK, TeamToOut(teamExist))
+	}
+}
+
+func AddTeamLead(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamExist, err := GetTeamById(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve team."})
+			return
+		}
+		var userExist models.User
+		if err := db.First(&userExist, "id = ?", c.Param("user_id")).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve user."})
+			return
+		}
+		if err := db.Model(&teamExist).Association("Leads").Append(&userExist); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add team lead"})
+			return
+		}
+		c.JSON(http.StatusOK, TeamToOut(teamExist))
+	}
+}
+
+func RemoveTeamLead(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamExist, err := GetTeamById(db, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve team."})
+			return
+		}
+		var userExist models.User
+		if err := db.First(&userExist, "id = ?", c.Param("user_id")).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve user."})
+			return
+		}
+		if err := db.Model(&teamExist).Association("Leads").Delete(&userExist); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove team lead"})
+			return
+		}
+		c.JSON(http.StatusOK, TeamToOut(teamExist))
+	}
+}
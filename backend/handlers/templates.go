@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"sfpr/models"
+	"sfpr/util"
+)
+
+type ShiftTemplateCreate struct {
+	Name            string    `json:"name" binding:"required"`
+	Description     *string   `json:"description"`
+	TeamID          *uint     `json:"teamId"`
+	HeadCount       uint8     `json:"headCount" binding:"required"`
+	Points          *uint8    `json:"points"`
+	DurationMinutes uint16    `json:"durationMinutes" binding:"required"`
+	Start           time.Time `json:"start" binding:"required"`
+	RRule           string    `json:"rrule" binding:"required"`
+}
+
+type ShiftTemplateUpdate struct {
+	Name            *string    `json:"name"`
+	Description     *string    `json:"description"`
+	TeamID          *uint      `json:"teamId"`
+	HeadCount       *uint8     `json:"headCount"`
+	Points          *uint8     `json:"points"`
+	DurationMinutes *uint16    `json:"durationMinutes"`
+	Start           *time.Time `json:"start"`
+	RRule           *string    `json:"rrule"`
+}
+
+// TemplateSync tells how the shifts of a template changed
+type TemplateSync struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+	// instances with people signed up or in the past are never touched
+	Kept int `json:"kept"`
+}
+
+type ShiftTemplateOut struct {
+	models.ShiftTemplate
+	Sync *TemplateSync `json:"sync,omitempty"`
+}
+
+// templateShift builds the concrete shift of a template starting at the given time
+func templateShift(template models.ShiftTemplate, start time.Time) models.Shift {
+	end := start.Add(time.Duration(template.DurationMinutes) * time.Minute)
+	shift := models.Shift{
+		Name:        template.Name,
+		Description: template.Description,
+		TeamID:      template.TeamID,
+		HeadCount:   template.HeadCount,
+		Points:      template.Points,
+		StartTime:   &start,
+		EndTime:     &end,
+		TemplateID:  &template.ID,
+	}
+	if day, ok := models.FindEventDay(start.In(models.EventLocation()).Format("2006-01-02")); ok {
+		shift.Day = &day.Name
+	}
+	return shift
+}
+
+// SyncTemplateShifts brings the shifts of a template in line with it. Shifts that already started or
+// have people signed up stay as they are, all other ones are updated, created or deleted.
+func SyncTemplateShifts(db *gorm.DB, template models.ShiftTemplate, now time.Time) (TemplateSync, error) {
+	sync := TemplateSync{}
+	rule, err := util.ParseRRule(template.RRule, models.EventLocation())
+	if err != nil {
+		return sync, err
+	}
+	occurrences, err := rule.Occurrences(template.Start.In(models.EventLocation()))
+	if err != nil {
+		return sync, err
+	}
+	var existing []models.Shift
+	if err := db.Preload("Users").Where("template_id = ?", template.ID).Find(&existing).Error; err != nil {
+		return sync, err
+	}
+
+	wanted := map[int64]time.Time{}
+	for _, occurrence := range occurrences {
+		wanted[occurrence.Unix()] = occurrence
+	}
+	covered := map[int64]bool{}
+	for _, shift := range existing {
+		if len(shift.Users) > 0 || shift.StartTime == nil || !shift.StartTime.After(now) {
+			if shift.StartTime != nil {
+				covered[shift.StartTime.Unix()] = true
+			}
+			sync.Kept++
+		}
+	}
+	for _, shift := range existing {
+		if len(shift.Users) > 0 || shift.StartTime == nil || !shift.StartTime.After(now) {
+			continue
+		}
+		occurrence, isWanted := wanted[shift.StartTime.Unix()]
+		if !isWanted || covered[occurrence.Unix()] {
+			if err := DeleteShift(db, shift); err != nil {
+				return sync, err
+			}
+			sync.Deleted++
+			continue
+		}
+		updated := templateShift(template, occurrence)
+		updated.ID = shift.ID
+		updated.CreatedAt = shift.CreatedAt
+		updated.ExternalKey = shift.ExternalKey
+		if err := db.Omit("Users").Save(&updated).Error; err != nil {
+			return sync, err
+		}
+		covered[occurrence.Unix()] = true
+		sync.Updated++
+	}
+	for _, occurrence := range occurrences {
+		if covered[occurrence.Unix()] || !occurrence.After(now) {
+			continue
+		}
+		shift := templateShift(template, occurrence)
+		if err := db.Create(&shift).Error; err != nil {
+			return sync, err
+		}
+		sync.Created++
+	}
+	return sync, nil
+}
+
+// ##########
+// Handlers
+// ##########
+
+func GetShiftTemplates(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var templates []models.ShiftTemplate
+		if err := db.Order("start asc").Find(&templates).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, templates)
+	}
+}
+
+// CreateShiftTemplate saves the template and generates its shifts
+func CreateShiftTemplate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var tc ShiftTemplateCreate
+		if err := c.ShouldBindJSON(&tc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		template := models.ShiftTemplate{
+			Name:            tc.Name,
+			Description:     tc.Description,
+			TeamID:          tc.TeamID,
+			HeadCount:       tc.HeadCount,
+			Points:          1,
+			DurationMinutes: tc.DurationMinutes,
+			Start:           tc.Start,
+			RRule:           tc.RRule,
+		}
+		if tc.Points != nil {
+			template.Points = *tc.Points
+		}
+		var sync TemplateSync
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&template).Error; err != nil {
+				return err
+			}
+			var err error
+			sync, err = SyncTemplateShifts(tx, template, time.Now())
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to create template: %s", err.Error())})
+			return
+		}
+		c.IndentedJSON(http.StatusCreated, ShiftTemplateOut{ShiftTemplate: template, Sync: &sync})
+	}
+}
+
+// PutShiftTemplate updates the template and passes the changes on to its future shifts without people
+func PutShiftTemplate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var template models.ShiftTemplate
+		if err := db.First(&template, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve template."})
+			return
+		}
+		var tu ShiftTemplateUpdate
+		if err := c.ShouldBindJSON(&tu); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if tu.Name != nil {
+			template.Name = *tu.Name
+		}
+		if tu.Description != nil {
+			template.Description = tu.Description
+		}
+		if tu.TeamID != nil && *tu.TeamID == 0 {
+			template.TeamID = nil
+		} else if tu.TeamID != nil {
+			template.TeamID = tu.TeamID
+		}
+		if tu.HeadCount != nil {
+			template.HeadCount = *tu.HeadCount
+		}
+		if tu.Points != nil {
+			template.Points = *tu.Points
+		}
+		if tu.DurationMinutes != nil {
+			template.DurationMinutes = *tu.DurationMinutes
+		}
+		if tu.Start != nil {
+			template.Start = *tu.Start
+		}
+		if tu.RRule != nil {
+			template.RRule = *tu.RRule
+		}
+
+		var sync TemplateSync
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&template).Error; err != nil {
+				return err
+			}
+			var err error
+			sync, err = SyncTemplateShifts(tx, template, time.Now())
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to update template: %s", err.Error())})
+			return
+		}
+		c.JSON(http.StatusOK, ShiftTemplateOut{ShiftTemplate: template, Sync: &sync})
+	}
+}
+
+// DeleteShiftTemplate removes the template and its future shifts without people, the other shifts stay
+func DeleteShiftTemplate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var template models.ShiftTemplate
+		if err := db.First(&template, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve template."})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			filled := tx.Model(&models.ShiftUser{}).Select("shift_id")
+			var unfilled []models.Shift
+			err := tx.Where("template_id = ? AND start_time > ? AND id NOT IN (?)", template.ID, time.Now(), filled).
+				Find(&unfilled).Error
+			if err != nil {
+				return err
+			}
+			for _, shift := range unfilled {
+				if err := DeleteShift(tx, shift); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&models.Shift{}).Where("template_id = ?", template.ID).Update("template_id", nil).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&template).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+			return
+		}
+		c.JSON(http.StatusOK, template)
+	}
+}
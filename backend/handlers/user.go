@@ -27,6 +27,9 @@ type UserUpdate struct {
 	SundayShift *string  `json:"sundayShift"`
 	Arrival     *string  `json:"arrival"`
 	SpotTypeID  *uint    `json:"spotTypeId"`
+
+	ShowFullName  *bool `json:"showFullName"`
+	OnLeaderboard *bool `json:"onLeaderboard"`
 }
 
 type UserCreate struct {
@@ -79,6 +82,12 @@ func updateUser(ue *models.User, uu UserUpdate) {
 	if uu.Arrival != nil {
 		ue.Arrival = uu.Arrival
 	}
+	if uu.ShowFullName != nil {
+		ue.ShowFullName = *uu.ShowFullName
+	}
+	if uu.OnLeaderboard != nil {
+		ue.OnLeaderboard = *uu.OnLeaderboard
+	}
 	if uu.SpotTypeID != nil && int(*uu.SpotTypeID) == 0 {
 		ue.SpotTypeID = nil
 	} else if uu.SpotTypeID != nil {
@@ -113,6 +122,18 @@ func UpdatePassword(ue *models.User, pw string) error {
 	return nil
 }
 
+// withShiftPoints loads users together with their pledged and earned shift points and their no-shows
+func withShiftPoints(db *gorm.DB) *gorm.DB {
+	userShifts := func() *gorm.DB {
+		return db.Table("shifts").Joins("join shift_users on shifts.id = shift_users.shift_id").Where("shift_users.user_id = users.id")
+	}
+	pledged := userShifts().Select("coalesce(sum(points), 0)").
+		Where("(shift_users.attendance IS NULL OR shift_users.attendance = ?)", models.AttendanceCompleted)
+	earned := userShifts().Select("coalesce(sum(points), 0)").Where("shift_users.attendance = ?", models.AttendanceCompleted)
+	noShows := userShifts().Select("count(*)").Where("shift_users.attendance = ?", models.AttendanceNoShow)
+	return db.Select("*, (?) as shift_points, (?) as earned_points, (?) as no_shows", pledged, earned, noShows)
+}
+
 func GetMe(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		username, exists := c.Get("username")
@@ -121,8 +142,7 @@ func GetMe(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		var userExist models.User
-		subQuery := db.Select("sum(points)").Joins("left join shift_users on shifts.id = shift_users.shift_id").Where("shift_users.user_id = users.id").Table("shifts")
-		query := db.Select("*, (?) as shift_points", subQuery)
+		query := withShiftPoints(db)
 		if err := query.Preload("SpotType").First(&userExist, "username = ?", username).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "User is not in DB."})
 			return
@@ -176,8 +196,7 @@ func PutMe(db *gorm.DB) gin.HandlerFunc {
 		db.Session(&gorm.Session{FullSaveAssociations: true}).Save(&userExist)
 
 		// full reload so that all fields are there for output
-		subQuery := db.Select("sum(points)").Joins("left join shift_users on shifts.id = shift_users.shift_id").Where("shift_users.user_id = users.id").Table("shifts")
-		query := db.Select("*, (?) as shift_points", subQuery)
+		query := withShiftPoints(db)
 		if err := query.Preload("SpotType").First(&userExist, "username = ?", username).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "User is not in DB."})
 			return
@@ -215,8 +234,7 @@ func GetUsers(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var users []models.User
 
-		subQuery := db.Select("sum(points)").Joins("left join shift_users on shifts.id = shift_users.shift_id").Where("shift_users.user_id = users.id").Table("shifts")
-		query := db.Select("*, (?) as shift_points", subQuery)
+		query := withShiftPoints(db)
 		if err := query.Preload("SpotType").Order("last_login desc").Find(&users).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
 			return
@@ -230,6 +248,27 @@ func GetUsers(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// GetUsersBelowQuota lists all users that still owe shift points for their Spot Type
+func GetUsersBelowQuota(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var users []models.User
+		withQuota := db.Model(&models.SpotType{}).Select("id").Where("required_points > 0")
+		query := withShiftPoints(db).Preload("SpotType").Where("spot_type_id IN (?)", withQuota)
+		if err := query.Order("nickname asc").Find(&users).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
+			return
+		}
+
+		belowQuota := []models.User{}
+		for _, user := range users {
+			if owed := user.PointsOwed(); owed != nil && *owed > 0 {
+				belowQuota = append(belowQuota, user)
+			}
+		}
+		c.IndentedJSON(http.StatusOK, models.ToUsersResponseList(belowQuota))
+	}
+}
+
 func GetUsersShort(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var users []models.User
@@ -237,7 +276,15 @@ func GetUsersShort(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Bad DB query"})
 			return
 		}
-		c.IndentedJSON(http.StatusOK, models.ToUsersShortResponseList(users))
+		// full names only for admins, the user themselves and users who made theirs public
+		viewer := rosterViewer(c, db)
+		usersOut := models.ToUsersShortResponseList(users)
+		for i, user := range users {
+			if !viewer.Admin && user.ID != viewer.UserID && !user.ShowFullName {
+				usersOut[i].FullName = nil
+			}
+		}
+		c.IndentedJSON(http.StatusOK, usersOut)
 	}
 }
 
@@ -7,6 +7,8 @@ import (
 	"sfpr/handlers"
 	"sfpr/models"
 	"sfpr/util"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -70,6 +72,104 @@ func addHausplatz(db *gorm.DB) {
 	}
 }
 
+// reminderConfig reads when shift reminders go out, e.g. SHIFT_REMINDERS=12h,1h
+func reminderConfig() handlers.ReminderConfig {
+	config := handlers.ReminderConfig{
+		Offsets:           []time.Duration{12 * time.Hour, time.Hour},
+		UnderstaffedAlert: 3 * time.Hour,
+		Interval:          5 * time.Minute,
+	}
+	if reminders, ok := os.LookupEnv("SHIFT_REMINDERS"); ok {
+		config.Offsets = []time.Duration{}
+		for _, offset := range strings.Split(reminders, ",") {
+			if strings.TrimSpace(offset) == "" {
+				continue
+			}
+			d, err := time.ParseDuration(strings.TrimSpace(offset))
+			if err != nil {
+				log.Println("Ignoring bad SHIFT_REMINDERS value", offset)
+				continue
+			}
+			config.Offsets = append(config.Offsets, d)
+		}
+	}
+	if alert, ok := os.LookupEnv("SHIFT_UNDERSTAFFED_ALERT"); ok {
+		d, err := time.ParseDuration(alert)
+		if err != nil {
+			log.Println("Ignoring bad SHIFT_UNDERSTAFFED_ALERT value", alert)
+		} else {
+			config.UnderstaffedAlert = d
+		}
+	}
+	return config
+}
+
+// signupLimitConfig reads the limits for self sign-ups, unset or bad values mean no limit
+func signupLimitConfig() models.SignupLimitConfig {
+	limits := models.SignupLimitConfig{}
+	for name, target := range map[string]*int{
+		"SIGNUP_MAX_POINTS_PER_DAY": &limits.MaxPointsPerDay,
+		"SIGNUP_MAX_SHIFTS_PER_DAY": &limits.MaxShiftsPerDay,
+	} {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				log.Println("Ignoring bad", name, "value", value)
+				continue
+			}
+			*target = n
+		}
+	}
+	for name, target := range map[string]*time.Duration{
+		"SIGNUP_MAX_CONSECUTIVE": &limits.MaxConsecutive,
+		"SIGNUP_MIN_REST":        &limits.MinRest,
+	} {
+		if value := os.Getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				log.Println("Ignoring bad", name, "value", value)
+				continue
+			}
+			*target = d
+		}
+	}
+	return limits
+}
+
+// eventConfig reads the timezone and the days of the event,
+// e.g. EVENT_DAYS=Freitag=2025-06-06,Samstag=2025-06-07
+func eventConfig() {
+	if tz := os.Getenv("EVENT_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			log.Fatal("Bad EVENT_TIMEZONE value ", tz)
+		}
+		models.SetEventLocation(loc)
+	}
+	days := []models.EventDay{}
+	for _, entry := range strings.Split(os.Getenv("EVENT_DAYS"), ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, date, found := strings.Cut(entry, "=")
+		parsed, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(date), models.EventLocation())
+		if !found || strings.TrimSpace(name) == "" || err != nil {
+			log.Fatal("Bad EVENT_DAYS value ", entry)
+		}
+		days = append(days, models.EventDay{Name: strings.TrimSpace(name), Date: parsed})
+	}
+	if len(days) > 0 {
+		models.SetEventDays(days)
+	} else {
+		log.Println("EVENT_DAYS is not set, falling back to the default event days from", models.EventDays()[0].Date.Format("2006-01-02"))
+		// keep the default days but move them to the configured timezone
+		for _, day := range models.EventDays() {
+			days = append(days, models.EventDay{Name: day.Name, Date: time.Date(day.Date.Year(), day.Date.Month(), day.Date.Day(), 0, 0, 0, 0, models.EventLocation())})
+		}
+		models.SetEventDays(days)
+	}
+}
+
 func main() {
 
 	env := os.Getenv("ENV")
@@ -88,13 +188,57 @@ func main() {
 	}
 
 	// Migrate the schema
-	err = db.AutoMigrate(&models.User{}, &models.SpotType{}, &models.Shift{})
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.SpotType{},
+		&models.Shift{},
+		&models.ShiftUser{},
+		&models.ShiftStandby{},
+		&models.ShiftTemplate{},
+		&models.Announcement{},
+		&models.ShiftSwap{},
+		&models.ShiftNotification{},
+		&models.Team{},
+		&models.Availability{},
+		&models.ShiftPreference{},
+		&models.Qualification{},
+		&models.UserQualification{},
+		&models.ShiftCategory{},
+		&models.ShiftLocation{},
+		&models.ShiftBuddy{},
+	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 	addAdmin(db)
 	addHausplatz(db)
 	models.SetSoliAmount(25)
+	eventConfig()
+
+	if value := os.Getenv("MISSING_POINTS_FEE"); value != "" {
+		if fee, err := strconv.ParseFloat(value, 32); err != nil {
+			log.Println("Ignoring bad MISSING_POINTS_FEE value", value)
+		} else {
+			models.SetMissingPointsFee(float32(fee))
+		}
+	}
+	// the deadline is midnight at the event, so eventConfig has to run first
+	if value := os.Getenv("POINTS_DEADLINE"); value != "" {
+		if deadline, err := time.ParseInLocation("2006-01-02", value, models.EventLocation()); err != nil {
+			log.Println("Ignoring bad POINTS_DEADLINE value", value)
+		} else {
+			models.SetPointsDeadline(&deadline)
+		}
+	}
+	if value := os.Getenv("SHIFT_REMOVAL_CUTOFF"); value != "" {
+		if cutoff, err := time.ParseDuration(value); err != nil {
+			log.Println("Ignoring bad SHIFT_REMOVAL_CUTOFF value", value)
+		} else {
+			models.SetSelfRemovalCutoff(cutoff)
+		}
+	}
+	models.SetRosterFinalized(os.Getenv("ROSTER_FINALIZED") == "true")
+	models.SetSignupLimits(signupLimitConfig())
 
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
@@ -111,6 +255,8 @@ func main() {
 	// Set the Site Password globally
 	util.SetSitePW(sitePW)
 
+	handlers.StartShiftReminders(db, reminderConfig())
+
 	// Initialize Gin router
 	r := handlers.SetupRouter(db)
 	// Run the server
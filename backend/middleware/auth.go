@@ -60,6 +60,7 @@ func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 		}
 		c.Set("username", username)
 		c.Set("user_id", userExist.ID)
+		c.Set("user_type", userExist.Type)
 		c.Next()
 	}
 }
@@ -87,8 +88,48 @@ func AdminMiddleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		c.Set("username", username)
-		c.Set("user_name", userExist.ID)
+		c.Set("user_id", userExist.ID)
+		c.Set("user_type", userExist.Type)
 		c.Set("admin", 1)
 		c.Next()
 	}
 }
+
+// TeamLeadMiddleware lets admins and leads of at least one team through.
+// For leads the IDs of their teams are set as "team_ids", so handlers can scope what they may change.
+func TeamLeadMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := getTokenUsername(c)
+		if username == "" {
+			return
+		}
+		var userExist models.User
+		if err := db.First(&userExist, "username = ?", username).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User is not in DB."})
+			c.Abort()
+			return
+		}
+		if !userExist.IsActivated {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User ist not activated yet. Please activate by clicking the Link in the Verfication Email."})
+			c.Abort()
+			return
+		}
+		c.Set("username", username)
+		c.Set("user_id", userExist.ID)
+		c.Set("user_type", userExist.Type)
+		if userExist.Type == "admin" {
+			c.Set("admin", 1)
+			c.Next()
+			return
+		}
+
+		var teamIDs []uint
+		if err := db.Table("team_leads").Where("user_id = ?", userExist.ID).Pluck("team_id", &teamIDs).Error; err != nil || len(teamIDs) == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Team leads only."})
+			c.Abort()
+			return
+		}
+		c.Set("team_ids", teamIDs)
+		c.Next()
+	}
+}
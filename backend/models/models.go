@@ -15,6 +15,128 @@ func SetSoliAmount(amount int) {
 	soliAmount = amount
 }
 
+// fee per shift point that is still missing after the points deadline
+var missingPointsFee float32
+var pointsDeadline *time.Time
+
+func MissingPointsFee() float32 {
+	return missingPointsFee
+}
+
+func SetMissingPointsFee(fee float32) {
+	missingPointsFee = fee
+}
+
+func PointsDeadline() *time.Time {
+	return pointsDeadline
+}
+
+func SetPointsDeadline(deadline *time.Time) {
+	pointsDeadline = deadline
+}
+
+// how long before a shift starts users can't remove themselves anymore, 0 for no cutoff
+var selfRemovalCutoff time.Duration
+
+// once the roster is finalized users can't sign up for shifts themselves anymore
+var rosterFinalized bool
+
+func SelfRemovalCutoff() time.Duration {
+	return selfRemovalCutoff
+}
+
+func SetSelfRemovalCutoff(cutoff time.Duration) {
+	selfRemovalCutoff = cutoff
+}
+
+func RosterFinalized() bool {
+	return rosterFinalized
+}
+
+func SetRosterFinalized(finalized bool) {
+	rosterFinalized = finalized
+}
+
+// SignupLimitConfig caps what users can sign up for on their own, zero values mean no cap.
+// Shifts directly following each other count as one stretch of work, between all other shifts
+// there has to be at least MinRest.
+type SignupLimitConfig struct {
+	MaxPointsPerDay int
+	MaxShiftsPerDay int
+	MaxConsecutive  time.Duration
+	MinRest         time.Duration
+}
+
+var signupLimits SignupLimitConfig
+
+func SignupLimits() SignupLimitConfig {
+	return signupLimits
+}
+
+func SetSignupLimits(limits SignupLimitConfig) {
+	signupLimits = limits
+}
+
+// EventDay is one day of the event, shifts refer to it by name
+type EventDay struct {
+	Name string    `json:"name"`
+	Date time.Time `json:"date"`
+}
+
+var eventLocation = loadEventLocation("Europe/Berlin")
+
+// default days of the 2025 event, set EVENT_DAYS for any other year
+var eventDays = []EventDay{
+	{Name: "Freitag", Date: time.Date(2025, 6, 6, 0, 0, 0, 0, eventLocation)},
+	{Name: "Samstag", Date: time.Date(2025, 6, 7, 0, 0, 0, 0, eventLocation)},
+	{Name: "Sonntag", Date: time.Date(2025, 6, 8, 0, 0, 0, 0, eventLocation)},
+	{Name: "Montag", Date: time.Date(2025, 6, 9, 0, 0, 0, 0, eventLocation)},
+}
+
+func loadEventLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// EventLocation is the timezone the event takes place in
+func EventLocation() *time.Location {
+	return eventLocation
+}
+
+func SetEventLocation(loc *time.Location) {
+	eventLocation = loc
+}
+
+func EventDays() []EventDay {
+	return eventDays
+}
+
+func SetEventDays(days []EventDay) {
+	eventDays = days
+}
+
+// FindEventDay looks up an event day by its name or its date (YYYY-MM-DD)
+func FindEventDay(nameOrDate string) (EventDay, bool) {
+	for _, day := range eventDays {
+		if day.Name == nameOrDate || day.Date.Format("2006-01-02") == nameOrDate {
+			return day, true
+		}
+	}
+	return EventDay{}, false
+}
+
+// EventDayNames lists the names of all event days, in order
+func EventDayNames() []string {
+	names := make([]string, len(eventDays))
+	for i, day := range eventDays {
+		names[i] = day.Name
+	}
+	return names
+}
+
 type User struct {
 	ID         uint    `gorm:"primarykey" json:"id"`
 	Username   *string `gorm:"null;index" json:"username"`
@@ -35,11 +157,20 @@ type User struct {
 	Arrival     *string `gorm:"null" json:"arrival"`
 	AvatarUrlSm *string `gorm:"null" json:"avatarUrlSm"`
 	AvatarUrlLg *string `gorm:"null" json:"avatarUrlLg"`
+	// whether other users may see the full name in shift rosters, admins and team leads always can
+	ShowFullName bool `gorm:"not null;default:false" json:"showFullName"`
+	// whether the user shows up on the shift points leaderboard (nickname and avatar only)
+	OnLeaderboard bool `gorm:"not null;default:false" json:"onLeaderboard"`
 
+	// pledged points of all shifts the user signed up for (without no-shows and excused ones)
 	ShiftPoints *uint16 `gorm:"->;default:0" json:"shiftPoints"`
+	// points of the shifts the user actually did
+	EarnedPoints *uint16 `gorm:"->;default:0" json:"earnedPoints"`
+	NoShows      *uint16 `gorm:"->;default:0" json:"noShows"`
 
 	VerificationToken *string    `gorm:"null" json:"-"`
 	TokenExpiryTime   *time.Time `gorm:"null" json:"-"`
+	CalendarToken     *string    `gorm:"null;uniqueIndex" json:"-"`
 
 	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
 	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
@@ -59,7 +190,24 @@ func (u User) AmountToPay() float32 {
 	if u.TakesSoli {
 		takesSoli = SoliAmount()
 	}
-	return u.SoliAmount - float32(takesSoli) - u.AmountPaid + float32(u.SpotType.Price) //
+	pointsFee := float32(0)
+	if owed := u.PointsOwed(); owed != nil && pointsDeadline != nil && time.Now().After(*pointsDeadline) {
+		pointsFee = float32(*owed) * MissingPointsFee()
+	}
+	return u.SoliAmount - float32(takesSoli) - u.AmountPaid + float32(u.SpotType.Price) + pointsFee //
+}
+
+// PointsOwed is the number of shift points still missing for the quota of the users Spot Type.
+// Is nil if the shift points were not loaded with the user.
+func (u User) PointsOwed() *uint16 {
+	if u.ShiftPoints == nil {
+		return nil
+	}
+	owed := uint16(0)
+	if u.SpotType != nil && uint16(u.SpotType.RequiredPoints) > *u.ShiftPoints {
+		owed = uint16(u.SpotType.RequiredPoints) - *u.ShiftPoints
+	}
+	return &owed
 }
 
 type UserResponse struct {
@@ -76,9 +224,14 @@ type UserResponse struct {
 	AmountToPay float32    `json:"amountToPay"`
 	AmountPaid  float32    `json:"amountPaid"`
 
-	SundayShift *string `json:"sundayShift"`
-	Arrival     *string `json:"arrival"`
-	ShiftPoints *uint16 `json:"shiftPoints"`
+	SundayShift   *string `json:"sundayShift"`
+	Arrival       *string `json:"arrival"`
+	ShowFullName  bool    `json:"showFullName"`
+	OnLeaderboard bool    `json:"onLeaderboard"`
+	ShiftPoints   *uint16 `json:"shiftPoints"`
+	EarnedPoints  *uint16 `json:"earnedPoints"`
+	NoShows       *uint16 `json:"noShows"`
+	PointsOwed    *uint16 `json:"pointsOwed"`
 
 	AvatarUrlSm *string `json:"avatarUrlSm"`
 	AvatarUrlLg *string `json:"avatarUrlLg"`
@@ -107,9 +260,15 @@ func (u User) ToResponse() UserResponse {
 		SundayShift: u.SundayShift,
 		Arrival:     u.Arrival,
 		AvatarUrlSm: u.AvatarUrlSm,
-		AvatarUrlLg: u.AvatarUrlLg,
 
-		ShiftPoints: u.ShiftPoints,
+		ShowFullName:  u.ShowFullName,
+		OnLeaderboard: u.OnLeaderboard,
+		AvatarUrlLg:   u.AvatarUrlLg,
+
+		ShiftPoints:  u.ShiftPoints,
+		EarnedPoints: u.EarnedPoints,
+		NoShows:      u.NoShows,
+		PointsOwed:   u.PointsOwed(),
 
 		SpotTypeID: u.SpotTypeID,
 		SpotType:   u.SpotType,
@@ -160,8 +319,13 @@ type SpotType struct {
 	Name         string  `gorm:"not null" json:"name"`
 	Price        uint16  `gorm:"not null" json:"price"`
 	Limit        uint16  `gorm:"not null" json:"limit"`
-	Description  *string `gorm:"null" json:"description"`
+	Description  *string `gorm:"null" json:"description"` // markdown
 	CurrentCount uint16  `gorm:"->" json:"currentCount"`
+	// the description rendered as sanitised HTML, not stored
+	DescriptionHTML *string `gorm:"-" json:"descriptionHtml"`
+
+	// shift points every user with this Spot Type has to collect
+	RequiredPoints uint8 `gorm:"not null;default:0" json:"requiredPoints"`
 
 	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
 	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
@@ -172,11 +336,254 @@ type Shift struct {
 	Name        string     `gorm:"not null" json:"name"`
 	HeadCount   uint8      `gorm:"not null" json:"headCount"`
 	Points      uint8      `gorm:"not null;default:1" json:"points"`
-	Description *string    `gorm:"null" json:"description"`
+	Description *string    `gorm:"null" json:"description"` // markdown
 	Day         *string    `gorm:"null" json:"day"`
 	StartTime   *time.Time `gorm:"null;default:null" json:"startTime"`
+	EndTime     *time.Time `gorm:"null;default:null" json:"endTime"`
+	TeamID      *uint      `gorm:"null;index" json:"teamId"`
+	CategoryID  *uint      `gorm:"null;index" json:"categoryId"`
+	LocationID  *uint      `gorm:"null;index" json:"locationId"`
 	Users       []*User    `gorm:"many2many:shift_users;"`
 
+	// the description rendered as sanitised HTML, not stored
+	DescriptionHTML *string `gorm:"-" json:"descriptionHtml"`
+
+	// who to ask about the shift on site
+	ContactName  *string `gorm:"null" json:"contactName"`
+	ContactPhone *string `gorm:"null" json:"contactPhone"`
+
+	// overrides the global self removal cutoff for this shift
+	RemovalDeadline *time.Time `gorm:"null;default:null" json:"removalDeadline"`
+	SignupClosed    bool       `gorm:"not null;default:false" json:"signupClosed"`
+
+	// key from the imported sheet, re-importing a row with the same key updates the shift
+	ExternalKey *string `gorm:"null;uniqueIndex" json:"externalKey"`
+	// set if the shift was generated from a recurring template
+	TemplateID *uint `gorm:"null;index" json:"templateId"`
+	// only users with all of these (verified) qualifications can sign up on their own
+	Qualifications []*Qualification `gorm:"many2many:shift_qualifications;" json:"qualifications"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+// SelfRemovalDeadline is the time after which users can't leave the shift on their own, nil if there is none
+func (s Shift) SelfRemovalDeadline() *time.Time {
+	if s.RemovalDeadline != nil {
+		return s.RemovalDeadline
+	}
+	if s.StartTime == nil || selfRemovalCutoff <= 0 {
+		return nil
+	}
+	deadline := s.StartTime.Add(-selfRemovalCutoff)
+	return &deadline
+}
+
+// SelfSignupClosed is true if users can't sign up for the shift on their own anymore
+func (s Shift) SelfSignupClosed() bool {
+	return rosterFinalized || s.SignupClosed
+}
+
+const (
+	AttendanceCompleted = "completed"
+	AttendanceNoShow    = "no_show"
+	AttendanceExcused   = "excused"
+)
+
+// ShiftUser is the join table between shifts and users, with the attendance of the user
+type ShiftUser struct {
+	ShiftID uint `gorm:"primaryKey" json:"shiftId"`
+	UserID  uint `gorm:"primaryKey" json:"userId"`
+
+	// nil until a team lead or admin confirms the attendance
+	Attendance      *string    `gorm:"null" json:"attendance"`
+	AttendanceSetAt *time.Time `gorm:"null" json:"attendanceSetAt"`
+	AttendanceSetBy *uint      `gorm:"null" json:"attendanceSetBy"`
+}
+
+func (ShiftUser) TableName() string {
+	return "shift_users"
+}
+
+// ShiftTemplate describes a recurring shift, the concrete shifts are generated from its recurrence rule
+type ShiftTemplate struct {
+	ID              uint    `gorm:"primarykey" json:"id"`
+	Name            string  `gorm:"not null" json:"name"`
+	Description     *string `gorm:"null" json:"description"`
+	TeamID          *uint   `gorm:"null;index" json:"teamId"`
+	HeadCount       uint8   `gorm:"not null" json:"headCount"`
+	Points          uint8   `gorm:"not null;default:1" json:"points"`
+	DurationMinutes uint16  `gorm:"not null" json:"durationMinutes"`
+	// start of the first shift
+	Start time.Time `gorm:"not null" json:"start"`
+	// subset of RFC 5545 RRULE, e.g. FREQ=HOURLY;INTERVAL=3;UNTIL=20250608T040000
+	RRule string `gorm:"not null" json:"rrule"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+// ShiftStandby is a place on the waiting list of a full shift, first come first served
+type ShiftStandby struct {
+	ID      uint `gorm:"primarykey" json:"id"`
+	ShiftID uint `gorm:"not null;uniqueIndex:idx_shift_standby" json:"shiftId"`
+	UserID  uint `gorm:"not null;uniqueIndex:idx_shift_standby" json:"userId"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+}
+
+type Announcement struct {
+	ID     uint   `gorm:"primarykey" json:"id"`
+	Title  string `gorm:"not null" json:"title"`
+	Body   string `gorm:"not null" json:"body"` // markdown
+	Pinned bool   `gorm:"not null;default:false" json:"pinned"`
+	// the body rendered as sanitised HTML, not stored
+	BodyHTML string `gorm:"-" json:"bodyHtml"`
+
+	// Audience - if set, only users with this Spot Type / user type get to see it
+	SpotTypeID *uint   `gorm:"null" json:"spotTypeId"`
+	UserType   *string `gorm:"null" json:"userType"`
+
+	AuthorID    *uint      `gorm:"null" json:"authorId"`
+	EmailSentAt *time.Time `gorm:"null;default:null" json:"emailSentAt"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+// ShiftSwap is an offer of a user to hand over their seat in a shift,
+// either to a specific user or to anyone who wants it
+type ShiftSwap struct {
+	ID           uint   `gorm:"primarykey" json:"id"`
+	ShiftID      uint   `gorm:"not null;index" json:"shiftId"`
+	Shift        *Shift `json:"-"`
+	FromUserID   uint   `gorm:"not null;index" json:"fromUserId"`
+	FromUser     *User  `json:"-"`
+	ToUserID     *uint  `gorm:"null" json:"toUserId"` // nil: open for everyone
+	Status       string `gorm:"not null;default:open" json:"status"`
+	AcceptedByID *uint  `gorm:"null" json:"acceptedById"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+const (
+	SwapOpen      = "open"
+	SwapAccepted  = "accepted"
+	SwapCancelled = "cancelled"
+)
+
+// ShiftBuddy is a request of a user to do a shift together with a friend.
+// Once the friend confirms, both get a seat at once or neither does.
+type ShiftBuddy struct {
+	ID         uint   `gorm:"primarykey" json:"id"`
+	ShiftID    uint   `gorm:"not null;index" json:"shiftId"`
+	Shift      *Shift `json:"-"`
+	FromUserID uint   `gorm:"not null;index" json:"fromUserId"`
+	FromUser   *User  `json:"-"`
+	ToUserID   uint   `gorm:"not null;index" json:"toUserId"`
+	ToUser     *User  `json:"-"`
+	Status     string `gorm:"not null;default:open" json:"status"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+const (
+	BuddyOpen      = "open"
+	BuddyConfirmed = "confirmed"
+	BuddyDeclined  = "declined"
+	BuddyCancelled = "cancelled"
+)
+
+// ShiftNotification remembers which reminders and alerts were already sent for a shift,
+// so they go out only once, also across restarts
+type ShiftNotification struct {
+	ID      uint   `gorm:"primarykey" json:"id"`
+	ShiftID uint   `gorm:"not null;uniqueIndex:idx_shift_notification" json:"shiftId"`
+	UserID  uint   `gorm:"not null;uniqueIndex:idx_shift_notification" json:"userId"` // 0 for alerts to all admins
+	Kind    string `gorm:"not null;uniqueIndex:idx_shift_notification" json:"kind"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+}
+
+// Team groups shifts (e.g. Bar, Kitchen, Awareness). Team leads can manage the shifts of their teams.
+type Team struct {
+	ID          uint    `gorm:"primarykey" json:"id"`
+	Name        string  `gorm:"not null;unique" json:"name"`
+	Description *string `gorm:"null" json:"description"`
+	Leads       []*User `gorm:"many2many:team_leads;" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+// Availability is a time window in which a user can do shifts.
+// Users without any windows count as always available.
+type Availability struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"userId"`
+	StartTime time.Time `gorm:"not null" json:"startTime"`
+	EndTime   time.Time `gorm:"not null" json:"endTime"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+// ShiftPreference is a like or dislike of a user for the shifts of a team
+type ShiftPreference struct {
+	ID     uint  `gorm:"primarykey" json:"id"`
+	UserID uint  `gorm:"not null;index" json:"userId"`
+	TeamID *uint `gorm:"null" json:"teamId"`
+	Likes  bool  `gorm:"not null" json:"likes"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+// Qualification is a skill some shifts need, e.g. a driver's licence or first-aid training
+type Qualification struct {
+	ID          uint    `gorm:"primarykey" json:"id"`
+	Name        string  `gorm:"not null;unique" json:"name"`
+	Description *string `gorm:"null" json:"description"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+// UserQualification is a qualification a user claims to have. It only counts once an admin verified it.
+type UserQualification struct {
+	ID              uint          `gorm:"primarykey" json:"id"`
+	UserID          uint          `gorm:"not null;uniqueIndex:idx_user_qualification" json:"userId"`
+	QualificationID uint          `gorm:"not null;uniqueIndex:idx_user_qualification" json:"qualificationId"`
+	Qualification   Qualification `json:"qualification"`
+	Verified        bool          `gorm:"not null;default:false" json:"verified"`
+	VerifiedAt      *time.Time    `gorm:"null" json:"verifiedAt"`
+	VerifiedByID    *uint         `gorm:"null" json:"verifiedById"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+// ShiftCategory is a kind of shift (e.g. Aufbau, Awareness), shown in its colour
+type ShiftCategory struct {
+	ID          uint    `gorm:"primarykey" json:"id"`
+	Name        string  `gorm:"not null;unique" json:"name"`
+	Color       string  `gorm:"not null;default:'#888888'" json:"color"`
+	Description *string `gorm:"null" json:"description"`
+
+	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
+	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
+}
+
+// ShiftLocation is a place on the site where shifts take place (e.g. Bar, Kitchen, Gate)
+type ShiftLocation struct {
+	ID          uint    `gorm:"primarykey" json:"id"`
+	Name        string  `gorm:"not null;unique" json:"name"`
+	Description *string `gorm:"null" json:"description"`
+	// where to find it on the site plan, e.g. a grid square like "C4"
+	SitePlanArea *string `gorm:"null" json:"sitePlanArea"`
+
 	CreatedAt time.Time `json:"createdAt"` // Automatically managed by GORM for creation time
 	UpdatedAt time.Time `json:"updatedAt"` // Automatically managed by GORM for update time
 }
@@ -3,8 +3,13 @@ package util
 import (
 	"errors"
 	"fmt"
+	"html"
+	"log"
+	"mime"
 	"net/smtp"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -44,6 +49,158 @@ func SetEmailConfig() {
 		fmt.Printf("WARNING: Email Sending is disabled. SMTP ENV variables are not fully set.")
 	}
 	fmt.Println("Email Sending is enabled from server", emailConfig.Host, "and address", emailConfig.Username)
+
+	if perMinute, err := strconv.Atoi(os.Getenv("SMTP_MAILS_PER_MINUTE")); err == nil && perMinute > 0 {
+		mailsPerMinute = perMinute
+	}
+}
+
+// Mail is a single message for the outgoing mail queue
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+	// optional HTML version of the body, sent along with the plain text
+	HTML string
+}
+
+// most providers only allow a limited amount of mails per minute,
+// so bulk mails are sent one after the other by a single worker
+var mailsPerMinute int = 20
+
+var mailQueue chan Mail
+var mailQueueOnce sync.Once
+
+func startMailWorker() {
+	mailQueue = make(chan Mail, 1000)
+	go func() {
+		ticker := time.NewTicker(time.Minute / time.Duration(mailsPerMinute))
+		defer ticker.Stop()
+		for m := range mailQueue {
+			<-ticker.C
+			if err := sendMail(m.To, buildMessage(m)); err != nil {
+				log.Println("Failed to send mail to", m.To, "with subject", m.Subject, ":", err.Error())
+			}
+		}
+	}()
+}
+
+// QueueMails hands the mails over to the background worker and returns immediately.
+// If email sending is disabled, the mails are only logged.
+func QueueMails(mails []Mail) {
+	if !EmailsEnabled {
+		for _, m := range mails {
+			fmt.Println("Cannot send Email to", m.To, "with subject", m.Subject)
+		}
+		return
+	}
+	mailQueueOnce.Do(startMailWorker)
+	go func() {
+		for _, m := range mails {
+			mailQueue <- m
+		}
+	}()
+}
+
+// mailBoundary separates the plain text and HTML parts of a mail
+const mailBoundary = "sfpr-alternative-boundary"
+
+func buildMessage(m Mail) []byte {
+	if m.HTML != "" {
+		return []byte(fmt.Sprintf(
+			"From: %s <%s>\r\n"+
+				"To: %s\r\n"+
+				"Subject: %s\r\n"+
+				"MIME-Version: 1.0\r\n"+
+				"Content-Type: multipart/alternative; boundary=\"%s\"\r\n"+
+				"\r\n"+
+				"--%s\r\n"+
+				"Content-Type: text/plain; charset=UTF-8\r\n"+
+				"\r\n"+
+				"%s\r\n"+
+				"--%s\r\n"+
+				"Content-Type: text/html; charset=UTF-8\r\n"+
+				"\r\n"+
+				"%s\r\n"+
+				"--%s--\r\n",
+			mime.QEncoding.Encode("utf-8", emailConfig.FromName), emailConfig.From, m.To,
+			mime.QEncoding.Encode("utf-8", m.Subject), mailBoundary,
+			mailBoundary, m.Body, mailBoundary, m.HTML, mailBoundary,
+		))
+	}
+	return []byte(fmt.Sprintf(
+		"From: %s <%s>\r\n"+
+			"To: %s\r\n"+
+			"Subject: %s\r\n"+
+			"MIME-Version: 1.0\r\n"+
+			"Content-Type: text/plain; charset=UTF-8\r\n"+
+			"\r\n"+
+			"%s",
+		mime.QEncoding.Encode("utf-8", emailConfig.FromName), emailConfig.From, m.To,
+		mime.QEncoding.Encode("utf-8", m.Subject), m.Body,
+	))
+}
+
+// sendMail delivers a single message and gives up after 10s
+func sendMail(to string, message []byte) error {
+	auth := smtp.PlainAuth(
+		"",
+		emailConfig.Username,
+		emailConfig.Password,
+		emailConfig.Host,
+	)
+
+	addr := fmt.Sprintf("%s:%d", emailConfig.Host, emailConfig.Port)
+	ch := make(chan error, 1)
+	go func() { ch <- smtp.SendMail(addr, auth, emailConfig.From, []string{to}, message) }()
+	select {
+	case err := <-ch:
+		return err
+
+	case <-time.After(10 * time.Second):
+		return errors.New("timout sending email")
+	}
+}
+
+// NotificationMail builds a short mail about something that happened to the user
+func NotificationMail(email string, nickname string, subject string, text string) Mail {
+	return Mail{
+		To:      email,
+		Subject: subject,
+		Body: fmt.Sprintf(
+			"Moin %s,\r\n"+
+				"\r\n"+
+				"%s\r\n"+
+				"\r\n"+
+				"Deine Schichten findest du unter %s\r\n"+
+				"Ciao Kakao <3",
+			nickname, text, FrontendBaseURL()+"/shifts",
+		),
+	}
+}
+
+// AnnouncementMail builds the mail for an announcement posted by an admin, the markdown body is sent as HTML too
+func AnnouncementMail(email string, nickname string, title string, body string) Mail {
+	return Mail{
+		To:      email,
+		Subject: title,
+		Body: fmt.Sprintf(
+			"Moin %s,\r\n"+
+				"\r\n"+
+				"%s\r\n"+
+				"\r\n"+
+				"Alle Neuigkeiten findest du auch unter %s\r\n"+
+				"Ciao Kakao <3",
+			nickname, body, FrontendBaseURL()+"/home",
+		),
+		HTML: fmt.Sprintf(
+			"<p>Moin %s,</p>\r\n"+
+				"%s\r\n"+
+				"<p>Alle Neuigkeiten findest du auch unter <a href=\"%s\">%s</a><br>\r\n"+
+				"Ciao Kakao &lt;3</p>",
+			html.EscapeString(nickname), RenderMarkdown(body), html.EscapeString(FrontendBaseURL()+"/home"), html.EscapeString(FrontendBaseURL()+"/home"),
+		),
+	}
 }
 
 // sendVerificationEmail sends an email with verification link
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CalendarEvent is a single VEVENT of an iCalendar feed (RFC 5545)
+type CalendarEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         *time.Time
+	AllDay      bool
+	// minutes before the start to remind at, 0 for no reminder
+	AlarmMinutes int
+}
+
+const icalDateTime = "20060102T150405Z"
+const icalDate = "20060102"
+
+// icalEscape escapes text values as described in RFC 5545 3.3.11
+func icalEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// icalFold splits content lines longer than 75 octets without breaking utf-8 characters
+func icalFold(line string) string {
+	var b strings.Builder
+	octets := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if octets+size > 75 {
+			b.WriteString("\r\n ")
+			octets = 1
+		}
+		b.WriteRune(r)
+		octets += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// ICalendar renders the events as a complete VCALENDAR
+func ICalendar(name string, events []CalendarEvent) string {
+	var b strings.Builder
+	write := func(line string) { b.WriteString(icalFold(line)) }
+	stamp := time.Now().UTC().Format(icalDateTime)
+
+	write("BEGIN:VCALENDAR")
+	write("VERSION:2.0")
+	write("PRODID:-//schoenfeld.fun//event-go//DE")
+	write("CALSCALE:GREGORIAN")
+	write("METHOD:PUBLISH")
+	write("X-WR-CALNAME:" + icalEscape(name))
+	for _, e := range events {
+		write("BEGIN:VEVENT")
+		write("UID:" + e.UID)
+		write("DTSTAMP:" + stamp)
+		if e.AllDay {
+			write("DTSTART;VALUE=DATE:" + e.Start.Format(icalDate))
+			end := e.Start.AddDate(0, 0, 1)
+			if e.End != nil {
+				end = *e.End
+			}
+			write("DTEND;VALUE=DATE:" + end.Format(icalDate))
+		} else {
+			write("DTSTART:" + e.Start.UTC().Format(icalDateTime))
+			if e.End != nil {
+				write("DTEND:" + e.End.UTC().Format(icalDateTime))
+			}
+		}
+		write("SUMMARY:" + icalEscape(e.Summary))
+		if e.Description != "" {
+			write("DESCRIPTION:" + icalEscape(e.Description))
+		}
+		if e.AlarmMinutes > 0 {
+			write("BEGIN:VALARM")
+			write("ACTION:DISPLAY")
+			write("DESCRIPTION:" + icalEscape(e.Summary))
+			write(fmt.Sprintf("TRIGGER:-PT%dM", e.AlarmMinutes))
+			write("END:VALARM")
+		}
+		write("END:VEVENT")
+	}
+	write("END:VCALENDAR")
+	return b.String()
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// admins paste their texts from chats and docs, so single line breaks are kept
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+)
+
+// links, lists, emphasis, tables etc. but no scripts, styles, iframes or event handlers
+var markdownPolicy = bluemonday.UGCPolicy().
+	RequireNoFollowOnLinks(true).
+	AddTargetBlankToFullyQualifiedLinks(true)
+
+// RenderMarkdown turns markdown into sanitised HTML that clients can show as it is
+func RenderMarkdown(text string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(text), &buf); err != nil {
+		log.Println("Failed to render markdown:", err.Error())
+		return markdownPolicy.Sanitize(text)
+	}
+	return markdownPolicy.Sanitize(buf.String())
+}
+
+// RenderOptionalMarkdown renders an optional text, nil stays nil
+func RenderOptionalMarkdown(text *string) *string {
+	if text == nil {
+		return nil
+	}
+	rendered := RenderMarkdown(*text)
+	return &rendered
+}
@@ -0,0 +1,129 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRule is the subset of RFC 5545 recurrence rules we need for shifts:
+// FREQ (HOURLY or DAILY), INTERVAL, COUNT, UNTIL and BYHOUR (only with DAILY),
+// e.g. "FREQ=HOURLY;INTERVAL=3;UNTIL=20250608T040000" or "FREQ=DAILY;BYHOUR=8,13,19;COUNT=9"
+type RRule struct {
+	Freq     string
+	Interval int
+	Count    int
+	Until    *time.Time
+	ByHour   []int
+}
+
+// more occurrences than this are most likely a typo in the rule
+const maxOccurrences = 500
+
+// ParseRRule parses a rule, times in UNTIL without a trailing Z are in the given location
+func ParseRRule(rule string, loc *time.Location) (RRule, error) {
+	r := RRule{Interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:"), ";") {
+		if part == "" {
+			continue
+		}
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return r, fmt.Errorf("invalid rule part %s", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if r.Freq != "HOURLY" && r.Freq != "DAILY" {
+				return r, fmt.Errorf("FREQ must be HOURLY or DAILY, not %s", value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return r, fmt.Errorf("invalid INTERVAL %s", value)
+			}
+			r.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return r, fmt.Errorf("invalid COUNT %s", value)
+			}
+			r.Count = count
+		case "UNTIL":
+			var until time.Time
+			var err error
+			if strings.HasSuffix(value, "Z") {
+				until, err = time.Parse("20060102T150405Z", value)
+			} else {
+				until, err = time.ParseInLocation("20060102T150405", value, loc)
+			}
+			if err != nil {
+				return r, fmt.Errorf("invalid UNTIL %s, expected YYYYMMDDTHHMMSS", value)
+			}
+			r.Until = &until
+		case "BYHOUR":
+			for _, h := range strings.Split(value, ",") {
+				hour, err := strconv.Atoi(h)
+				if err != nil || hour < 0 || hour > 23 {
+					return r, fmt.Errorf("invalid BYHOUR %s", h)
+				}
+				r.ByHour = append(r.ByHour, hour)
+			}
+			sort.Ints(r.ByHour)
+		default:
+			return r, fmt.Errorf("%s is not supported", key)
+		}
+	}
+	if r.Freq == "" {
+		return r, errors.New("FREQ is missing")
+	}
+	if r.Count == 0 && r.Until == nil {
+		return r, errors.New("COUNT or UNTIL is needed")
+	}
+	if len(r.ByHour) > 0 && r.Freq != "DAILY" {
+		return r, errors.New("BYHOUR only works with FREQ=DAILY")
+	}
+	return r, nil
+}
+
+func (r RRule) done(occurrences []time.Time, next time.Time) bool {
+	if r.Count > 0 && len(occurrences) >= r.Count {
+		return true
+	}
+	return r.Until != nil && next.After(*r.Until)
+}
+
+// Occurrences lists all start times of the rule, beginning with start
+func (r RRule) Occurrences(start time.Time) ([]time.Time, error) {
+	occurrences := []time.Time{}
+	for i := 0; ; i++ {
+		var candidates []time.Time
+		if r.Freq == "HOURLY" {
+			candidates = []time.Time{start.Add(time.Duration(i*r.Interval) * time.Hour)}
+		} else {
+			day := start.AddDate(0, 0, i*r.Interval)
+			if len(r.ByHour) == 0 {
+				candidates = []time.Time{day}
+			}
+			for _, hour := range r.ByHour {
+				candidate := time.Date(day.Year(), day.Month(), day.Day(), hour, start.Minute(), 0, 0, day.Location())
+				// the first day only starts at DTSTART
+				if !candidate.Before(start) {
+					candidates = append(candidates, candidate)
+				}
+			}
+		}
+		for _, candidate := range candidates {
+			if r.done(occurrences, candidate) {
+				return occurrences, nil
+			}
+			occurrences = append(occurrences, candidate)
+			if len(occurrences) > maxOccurrences {
+				return nil, fmt.Errorf("the rule has more than %d occurrences", maxOccurrences)
+			}
+		}
+	}
+}
@@ -44,11 +44,39 @@ export interface User {
     price: number;
     limit: number;
     description: string | null;
+    descriptionHtml: string | null; // sanitised HTML rendering of the markdown description
     currentCount: number;
     createdAt?: string;
     updatedAt?: string;
   }
   
+  export interface ShiftParticipant {
+    id: number;
+    nickname: string;
+    fullName: string | null; // only if the user made it public (or for admins)
+    avatarUrlSm: string | null;
+  }
+
+  export interface Qualification {
+    id: number;
+    name: string;
+    description: string | null;
+  }
+
+  export interface ShiftCategory {
+    id: number;
+    name: string;
+    color: string; // #rrggbb
+    description: string | null;
+  }
+
+  export interface ShiftLocation {
+    id: number;
+    name: string;
+    description: string | null;
+    sitePlanArea: string | null;
+  }
+
   // Define the Shift type to match your API structure
   export interface Shift {
     id: number;
@@ -57,8 +85,16 @@ export interface User {
     points: number;
     day: string;
     description: string | null;
+    descriptionHtml: string | null; // sanitised HTML rendering of the markdown description
     startTime: string | null; // We'll parse this later
     currentCount: number;
     userNames: string[] | null;
+    participants: ShiftParticipant[];
+    qualifications: Qualification[];
+    eligible: boolean; // the current user has all qualifications
+    categoryId: number | null;
+    locationId: number | null;
+    contactName: string | null;
+    contactPhone: string | null;
   }
   